@@ -0,0 +1,197 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"sort"
+	"strings"
+)
+
+// An AttributeDescription is an attribute type together with its options,
+// e.g. "description;lang-de" or "userCertificate;binary" (RFC 4512 section 2.5).
+type AttributeDescription struct {
+	Type    string
+	Options []string
+}
+
+// ParseAttributeDescription splits an attribute description into the attribute
+// type and its options.
+func ParseAttributeDescription(s string) AttributeDescription {
+	parts := strings.Split(s, ";")
+	return AttributeDescription{Type: parts[0], Options: parts[1:]}
+}
+
+// Returns the attribute description in its textual form
+func (a AttributeDescription) String() string {
+	return strings.Join(append([]string{a.Type}, a.Options...), ";")
+}
+
+// HasOption reports if the attribute description has option. Options are
+// compared case-insensitively.
+func (a AttributeDescription) HasOption(option string) bool {
+	for _, v := range a.Options {
+		if strings.EqualFold(v, option) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Equal reports if two attribute descriptions describe the same attribute. The type
+// and options are compared case-insensitively, the order of the options is irrelevant.
+func (a AttributeDescription) Equal(b AttributeDescription) bool {
+	return a.key() == b.key()
+}
+
+// withoutOption returns a copy of the attribute description without option
+func (a AttributeDescription) withoutOption(option string) AttributeDescription {
+	b := AttributeDescription{Type: a.Type}
+	for _, v := range a.Options {
+		if !strings.EqualFold(v, option) {
+			b.Options = append(b.Options, v)
+		}
+	}
+
+	return b
+}
+
+// key returns the normalized form of the attribute description, which is used to compare
+// descriptions. It is the lower cased type followed by the sorted, lower cased options.
+func (a AttributeDescription) key() string {
+	options := make([]string, 0, len(a.Options))
+	for _, v := range a.Options {
+		v = strings.ToLower(v)
+		if !containsString(options, v) {
+			options = append(options, v)
+		}
+	}
+	sort.Strings(options)
+
+	return strings.Join(append([]string{strings.ToLower(a.Type)}, options...), ";")
+}
+
+// attributeKey returns the normalized form of the attribute description name
+func attributeKey(name string) string {
+	return ParseAttributeDescription(name).key()
+}
+
+// GetAttributeBinaryValues returns the values of the attribute name of entry as byte slices.
+// As the "binary" option only specifies the transfer encoding, it is ignored when comparing
+// attribute descriptions, all other options must match.
+func GetAttributeBinaryValues(entry *ldap.Entry, name string) [][]byte {
+	key := ParseAttributeDescription(name).withoutOption("binary").key()
+
+	values := make([][]byte, 0)
+	for _, v := range entry.Attributes {
+		if ParseAttributeDescription(v.Name).withoutOption("binary").key() != key {
+			continue
+		}
+
+		for _, w := range v.Values {
+			values = append(values, []byte(w))
+		}
+	}
+
+	return values
+}
+
+// GetAttributeBinaryValue returns the first value of the attribute name of entry as byte slice,
+// or nil if the attribute has no values.
+func GetAttributeBinaryValue(entry *ldap.Entry, name string) []byte {
+	values := GetAttributeBinaryValues(entry, name)
+	if len(values) == 0 {
+		return nil
+	}
+
+	return values[0]
+}
+
+// AddAttributeBinaryValues adds the byte slices in values to the attribute name of entry.
+// Empty values are skipped, so an unset single-valued attribute can be passed directly.
+func AddAttributeBinaryValues(entry *ldap.Entry, name string, values ...[]byte) {
+	strValues := make([]string, 0, len(values))
+	for _, v := range values {
+		if len(v) > 0 {
+			strValues = append(strValues, string(v))
+		}
+	}
+
+	if len(strValues) > 0 {
+		entry.AddAttributeValues(name, strValues)
+	}
+}
+
+// attributeSet holds the attributes of an entry keyed by their normalized attribute
+// description. Values of attributes with equal descriptions are merged.
+type attributeSet struct {
+	// keys in the order of first appearance
+	keys []string
+
+	attributes map[string]*ldap.EntryAttribute
+}
+
+// newAttributeSet creates an attributeSet of the attributes of entry
+func newAttributeSet(entry *ldap.Entry) *attributeSet {
+	s := &attributeSet{attributes: make(map[string]*ldap.EntryAttribute)}
+
+	for _, v := range entry.Attributes {
+		key := attributeKey(v.Name)
+		attr, ok := s.attributes[key]
+		if !ok {
+			attr = &ldap.EntryAttribute{Name: v.Name}
+			s.attributes[key] = attr
+			s.keys = append(s.keys, key)
+		}
+
+		attr.Values = append(attr.Values, v.Values...)
+	}
+
+	return s
+}
+
+// Do the string slices contain the same values, regardless of order?
+// Values are compared byte-wise, so this works for binary values too.
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	count := make(map[string]int)
+	for _, v := range a {
+		count[v]++
+	}
+
+	for _, v := range b {
+		if count[v] == 0 {
+			return false
+		}
+		count[v]--
+	}
+
+	return true
+}
+
+// diffValues returns the values which are in a but not in b (deleted) and the
+// values which are in b but not in a (added).
+func diffValues(a, b []string) (deleted, added []string) {
+	inA := make(map[string]bool)
+	for _, v := range a {
+		inA[v] = true
+	}
+
+	inB := make(map[string]bool)
+	for _, v := range b {
+		inB[v] = true
+		if !inA[v] {
+			added = append(added, v)
+		}
+	}
+
+	for _, v := range a {
+		if !inB[v] {
+			deleted = append(deleted, v)
+		}
+	}
+
+	return deleted, added
+}
@@ -0,0 +1,85 @@
+package crud
+
+import (
+	"bytes"
+	"github.com/rbns/ldap"
+	"testing"
+)
+
+func TestAttributeDescription(t *testing.T) {
+	a := ParseAttributeDescription("description;lang-de")
+	if a.Type != "description" || !equalStringSlice(a.Options, []string{"lang-de"}) {
+		t.Error("unexpected attribute description:", a)
+	}
+
+	if !a.Equal(ParseAttributeDescription("DESCRIPTION;Lang-DE")) {
+		t.Error("attribute descriptions differing in case aren't equal")
+	}
+
+	if a.Equal(ParseAttributeDescription("description")) {
+		t.Error("attribute description with option equals base attribute")
+	}
+
+	b := ParseAttributeDescription("userCertificate;binary;lang-en")
+	if !b.Equal(ParseAttributeDescription("usercertificate;lang-en;binary")) {
+		t.Error("attribute descriptions differing in option order aren't equal")
+	}
+
+	if !b.HasOption("BINARY") || b.String() != "userCertificate;binary;lang-en" {
+		t.Error("unexpected attribute description:", b)
+	}
+}
+
+func TestBinaryValues(t *testing.T) {
+	photo := []byte{0xff, 0xd8, 0x00, 0x10}
+
+	entry := ldap.NewEntry("")
+	AddAttributeBinaryValues(entry, "jpegPhoto", photo, nil)
+	AddAttributeBinaryValues(entry, "userCertificate;binary", []byte{0x30, 0x82})
+
+	values := GetAttributeBinaryValues(entry, "JPEGPhoto")
+	if len(values) != 1 || !bytes.Equal(values[0], photo) {
+		t.Error("unexpected jpegPhoto values:", values)
+	}
+
+	if !bytes.Equal(GetAttributeBinaryValue(entry, "userCertificate"), []byte{0x30, 0x82}) {
+		t.Error("userCertificate;binary wasn't found as userCertificate")
+	}
+
+	if GetAttributeBinaryValue(entry, "userCertificate;lang-de") != nil {
+		t.Error("userCertificate;binary was found as userCertificate;lang-de")
+	}
+}
+
+func TestNewModifyRequest(t *testing.T) {
+	c := New(nil, "dc=example,dc=com")
+
+	oldItem := NewDynamic("cn=Fritz")
+	oldItem.Set("cn", "Fritz")
+	oldItem.Set("description", "a person")
+	oldItem.Set("description;lang-de", "eine Person")
+	oldItem.SetBinary("jpegPhoto", []byte{0xff, 0xd8, 0x00})
+
+	newItem := oldItem.Copy().(*Dynamic)
+	newItem.Remove("description;LANG-DE")
+	newItem.SetBinary("jpegPhoto", []byte{0xff, 0xd8, 0x01})
+	newItem.Set("DESCRIPTION", "a person")
+
+	modifyRequest, err := c.newModifyRequest(oldItem, newItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(modifyRequest.Mods) != 2 {
+		t.Fatal("Expected exactly two modifications, got", modifyRequest.Mods)
+	}
+
+	if modifyRequest.Mods[0].ModOperation != ldap.ModDelete || modifyRequest.Mods[0].Modification.Name != "description;lang-de" {
+		t.Error("unexpected first modification:", modifyRequest.Mods[0])
+	}
+
+	if modifyRequest.Mods[1].ModOperation != ldap.ModReplace || modifyRequest.Mods[1].Modification.Name != "jpegPhoto" ||
+		!equalStringSlice(modifyRequest.Mods[1].Modification.Values, []string{"\xff\xd8\x01"}) {
+		t.Error("unexpected second modification:", modifyRequest.Mods[1])
+	}
+}
@@ -0,0 +1,328 @@
+package crud
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rbns/ldap"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Value recorded instead of the values of redacted attributes
+const redacted = "[redacted]"
+
+// An AuditRecord describes a successful write.
+type AuditRecord struct {
+	Time time.Time
+
+	// Authorization identity the write was done with, as returned by WhoAmI
+	Actor string `json:",omitempty"`
+
+	// Operation as returned by Operation.String, e.g. "update"
+	Operation string
+
+	// DN of the entry written, with the base DN
+	Dn string
+
+	// New RDN and superior of renames
+	NewRdn       string `json:",omitempty"`
+	DeleteOldRdn bool   `json:",omitempty"`
+	NewSuperior  string `json:",omitempty"`
+
+	// Attributes added by creates and modified by updates
+	Changes []AuditChange `json:",omitempty"`
+}
+
+// An AuditChange is the modification of a single attribute.
+type AuditChange struct {
+	Attribute string
+
+	// "add", "delete" or "replace"
+	Operation string
+
+	// Values added, deleted or replacing the old values
+	Values []string `json:",omitempty"`
+
+	// Values of the attribute before and after the change, if known
+	Before []string `json:",omitempty"`
+	After  []string `json:",omitempty"`
+}
+
+// An AuditSink stores AuditRecords.
+type AuditSink interface {
+	WriteAudit(r *AuditRecord) error
+}
+
+// An Auditor records the successful writes of the Managers using its Interceptor, that
+// is creates, updates, deletes, renames and password changes, in its sinks. Writes in dry
+// run mode aren't recorded.
+type Auditor struct {
+	// Attributes whose values are replaced with "[redacted]" in the records, compared
+	// case-insensitively and without options
+	Redact []string
+
+	// Returns the actor of an operation. If nil, WhoAmI of the Manager doing the
+	// operation is used, which takes an additional request.
+	Actor func(inv *Invocation) (string, error)
+
+	sinks []AuditSink
+
+	// clock, replaced in tests
+	now func() time.Time
+}
+
+// NewAuditor creates an Auditor writing to sinks, redacting the common password
+// attributes.
+func NewAuditor(sinks ...AuditSink) *Auditor {
+	return &Auditor{
+		Redact: []string{"userPassword", "authPassword", "unicodePwd", "sambaLMPassword", "sambaNTPassword"},
+		sinks:  sinks,
+		now:    time.Now,
+	}
+}
+
+// Interceptor returns the Interceptor recording writes, to be passed to WithInterceptors.
+// If writing a record fails, the error is returned although the write was done.
+func (a *Auditor) Interceptor() Interceptor {
+	return func(inv *Invocation, next Handler) error {
+		err := next(inv)
+		if err != nil || inv.Manager.dryRun != nil {
+			return err
+		}
+
+		switch inv.Operation {
+		case OperationRead, OperationReadAll, OperationCompare:
+			return nil
+		}
+
+		r, err := a.record(inv)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range a.sinks {
+			err = v.WriteAudit(r)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// record creates the AuditRecord of a successful write
+func (a *Auditor) record(inv *Invocation) (*AuditRecord, error) {
+	r := &AuditRecord{Time: a.now(), Operation: inv.Operation.String(), Dn: inv.Dn}
+
+	var err error
+	if a.Actor != nil {
+		r.Actor, err = a.Actor(inv)
+	} else {
+		r.Actor, err = inv.Manager.WhoAmI()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch request := inv.Request.(type) {
+	case *ldap.AddRequest:
+		for _, v := range request.Entry.Attributes {
+			r.Changes = append(r.Changes, AuditChange{Attribute: v.Name, Operation: "add", Values: v.Values, After: v.Values})
+		}
+	case *ldap.ModifyRequest:
+		r.Changes, err = modifyChanges(request, inv.Old, inv.Item)
+		if err != nil {
+			return nil, err
+		}
+	case *ldap.ModifyDNRequest:
+		r.NewRdn = request.NewRDN
+		r.DeleteOldRdn = request.DeleteOldRDN
+		r.NewSuperior = request.NewSuperior
+	}
+
+	if inv.Operation == OperationPasswd {
+		if r.Dn == "" {
+			r.Dn = strings.TrimPrefix(r.Actor, "dn:")
+		}
+
+		r.Changes = []AuditChange{{Attribute: "userPassword", Operation: "replace"}}
+	}
+
+	a.redact(r)
+	return r, nil
+}
+
+// modifyChanges returns the changes of a modify request with the values before and
+// after the change, if the old and new Items are known
+func modifyChanges(modifyRequest *ldap.ModifyRequest, oldItem, newItem Item) ([]AuditChange, error) {
+	var before, after *attributeSet
+	if oldItem != nil && newItem != nil {
+		oldEntry, err := oldItem.MarshalLDAP()
+		if err != nil {
+			return nil, err
+		}
+
+		newEntry, err := newItem.MarshalLDAP()
+		if err != nil {
+			return nil, err
+		}
+
+		before, after = newAttributeSet(oldEntry), newAttributeSet(newEntry)
+	}
+
+	changes := make([]AuditChange, len(modifyRequest.Mods))
+	for i, v := range modifyRequest.Mods {
+		changes[i] = AuditChange{Attribute: v.Modification.Name, Values: v.Modification.Values}
+
+		switch v.ModOperation {
+		case ldap.ModAdd:
+			changes[i].Operation = "add"
+		case ldap.ModDelete:
+			changes[i].Operation = "delete"
+		case ldap.ModReplace:
+			changes[i].Operation = "replace"
+		}
+
+		if before != nil {
+			key := attributeKey(v.Modification.Name)
+			if attr, ok := before.attributes[key]; ok {
+				changes[i].Before = attr.Values
+			}
+			if attr, ok := after.attributes[key]; ok {
+				changes[i].After = attr.Values
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// redact replaces the values of the redacted attributes in r
+func (a *Auditor) redact(r *AuditRecord) {
+	for i, v := range r.Changes {
+		attr := ParseAttributeDescription(v.Attribute).Type
+		for _, name := range a.Redact {
+			if strings.EqualFold(attr, name) {
+				r.Changes[i].Values = redactValues(v.Values)
+				r.Changes[i].Before = redactValues(v.Before)
+				r.Changes[i].After = redactValues(v.After)
+				break
+			}
+		}
+	}
+}
+
+// redactValues returns a slice of as many redacted values as values has
+func redactValues(values []string) []string {
+	if values == nil {
+		return nil
+	}
+
+	r := make([]string, len(values))
+	for i := range r {
+		r[i] = redacted
+	}
+
+	return r
+}
+
+// jsonAuditSink writes records as JSON lines
+type jsonAuditSink struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONAuditSink returns an AuditSink writing each record as a line of JSON to w,
+// e.g. a file opened for appending.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *jsonAuditSink) WriteAudit(r *AuditRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.encoder.Encode(r)
+}
+
+// ldapAuditSink adds records as entries of the accesslog schema
+type ldapAuditSink struct {
+	manager *Manager
+	dn      string
+
+	mutex sync.Mutex
+	last  time.Time
+}
+
+// NewLDAPAuditSink returns an AuditSink adding each record as an entry below dn, e.g.
+// "ou=audit", using m. The entries use the schema of the accesslog overlay (auditAdd,
+// auditModify, auditDelete and auditModRDN), which the server needs to know. They are
+// named by their reqStart attribute, which is made unique by advancing it by a
+// microsecond if necessary.
+//
+// m mustn't use the Interceptor of the Auditor writing to the sink.
+func NewLDAPAuditSink(m *Manager, dn string) AuditSink {
+	return &ldapAuditSink{manager: m, dn: dn}
+}
+
+func (s *ldapAuditSink) WriteAudit(r *AuditRecord) error {
+	s.mutex.Lock()
+	start := r.Time.UTC().Truncate(time.Microsecond)
+	if !start.After(s.last) {
+		start = s.last.Add(time.Microsecond)
+	}
+	s.last = start
+	s.mutex.Unlock()
+
+	reqStart := start.Format("20060102150405.000000Z")
+
+	objectClass, reqType := "auditModify", "modify"
+	switch r.Operation {
+	case OperationCreate.String():
+		objectClass, reqType = "auditAdd", "add"
+	case OperationDelete.String(), OperationDeleteSubtree.String():
+		objectClass, reqType = "auditDelete", "delete"
+	case OperationRename.String():
+		objectClass, reqType = "auditModRDN", "modrdn"
+	}
+
+	d := NewDynamic("reqStart=" + reqStart + "," + s.dn)
+	d.Set("objectClass", objectClass)
+	d.Set("reqStart", reqStart)
+	d.Set("reqEnd", reqStart)
+	d.Set("reqType", reqType)
+	d.Set("reqSession", "0")
+	d.Set("reqResult", "0")
+	d.Set("reqDN", r.Dn)
+
+	if strings.HasPrefix(r.Actor, "dn:") {
+		d.Set("reqAuthzID", strings.TrimPrefix(r.Actor, "dn:"))
+	}
+
+	if reqType == "modrdn" {
+		d.Set("reqNewRDN", r.NewRdn)
+		d.Set("reqDeleteOldRDN", strings.ToUpper(fmt.Sprint(r.DeleteOldRdn)))
+		if r.NewSuperior != "" {
+			d.Set("reqNewSuperior", r.NewSuperior)
+		}
+	}
+
+	symbols := map[string]string{"add": "+", "delete": "-", "replace": "="}
+	for _, v := range r.Changes {
+		if len(v.Values) == 0 {
+			d.Add("reqMod", v.Attribute+":"+symbols[v.Operation])
+		}
+		for _, value := range v.Values {
+			d.Add("reqMod", v.Attribute+":"+symbols[v.Operation]+" "+value)
+		}
+
+		for _, value := range v.Before {
+			d.Add("reqOld", v.Attribute+": "+value)
+		}
+	}
+
+	return s.manager.Create(d)
+}
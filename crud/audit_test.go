@@ -0,0 +1,104 @@
+package crud
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditor(t *testing.T) {
+	var jsonLines, entries bytes.Buffer
+
+	ldapSink := NewLDAPAuditSink(New(nil, "").DryRun(ldif.NewWriter(&entries)), "ou=audit,dc=example,dc=com")
+	a := NewAuditor(NewJSONAuditSink(&jsonLines), ldapSink)
+	a.Actor = func(*Invocation) (string, error) {
+		return "dn:cn=admin,dc=example,dc=com", nil
+	}
+	a.now = func() time.Time {
+		return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+
+	stored := ldap.NewEntry("uid=fritz")
+	stored.AddAttributeValues("objectClass", []string{"inetOrgPerson"})
+	stored.AddAttributeValues("cn", []string{"Fritz"})
+	stored.AddAttributeValues("userPassword", []string{"secret"})
+
+	// answer reads with stored and skip writes, as there is no server
+	server := func(inv *Invocation, next Handler) error {
+		if inv.Operation == OperationRead {
+			inv.Entries = []*ldap.Entry{copyEntry(stored)}
+		}
+
+		return nil
+	}
+
+	c := New(nil, "dc=example,dc=com").WithInterceptors(a.Interceptor(), server)
+
+	fritz := NewDynamic("uid=fritz")
+	fritz.Set("objectClass", "inetOrgPerson")
+	fritz.Set("cn", "Fritz")
+	fritz.Set("userPassword", "secret")
+
+	err := c.Create(fritz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fritz.Set("cn", "Gonzo")
+	fritz.Set("userPassword", "geheim")
+	err = c.Update(fritz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Delete(fritz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(jsonLines.String(), "secret") || strings.Contains(jsonLines.String(), "geheim") {
+		t.Error("expected passwords to be redacted:", jsonLines.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(jsonLines.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(lines))
+	}
+
+	var update AuditRecord
+	err = json.Unmarshal([]byte(lines[1]), &update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if update.Operation != "update" || update.Dn != "uid=fritz,dc=example,dc=com" || update.Actor != "dn:cn=admin,dc=example,dc=com" {
+		t.Errorf("unexpected record: %+v", update)
+	}
+
+	if len(update.Changes) != 2 || update.Changes[0].Attribute != "cn" ||
+		!equalStringSlice(update.Changes[0].Before, []string{"Fritz"}) || !equalStringSlice(update.Changes[0].After, []string{"Gonzo"}) ||
+		!equalStringSlice(update.Changes[1].Before, []string{redacted}) {
+		t.Errorf("unexpected changes: %+v", update.Changes)
+	}
+
+	expected := "\ndn: reqStart=20240102030405.000001Z,ou=audit,dc=example,dc=com\nchangetype: add\n" +
+		"objectClass: auditModify\nreqStart: 20240102030405.000001Z\nreqEnd: 20240102030405.000001Z\n" +
+		"reqType: modify\nreqSession: 0\nreqResult: 0\nreqDN: uid=fritz,dc=example,dc=com\n" +
+		"reqAuthzID: cn=admin,dc=example,dc=com\nreqMod: cn:= Gonzo\nreqMod: userPassword:= [redacted]\n" +
+		"reqOld: cn: Fritz\nreqOld: userPassword: [redacted]\n"
+
+	if !strings.Contains(entries.String(), expected) {
+		t.Errorf("unexpected audit entries:\n%v", entries.String())
+	}
+
+	// writes in dry run mode aren't recorded
+	jsonLines.Reset()
+	err = c.DryRun(ldif.NewWriter(&bytes.Buffer{})).Delete(fritz)
+	if err != nil || jsonLines.Len() != 0 {
+		t.Error("expected no record in dry run mode:", err, jsonLines.String())
+	}
+}
@@ -0,0 +1,134 @@
+package crud
+
+import (
+	"errors"
+	"github.com/rbns/ldap"
+	"log"
+	"strings"
+)
+
+// ErrEmptyPassword is returned by Authenticate for empty passwords. A simple bind with an
+// empty password is an unauthenticated bind (RFC 4513 section 5.1.2), which succeeds
+// on most servers regardless of the DN.
+var ErrEmptyPassword = errors.New("Empty password.")
+
+// ErrInvalidCredentials is returned by Authenticate if the DN or the password are wrong.
+var ErrInvalidCredentials = errors.New("Invalid credentials.")
+
+// ErrAccountLocked is returned by Authenticate if the account is locked or disabled.
+var ErrAccountLocked = errors.New("Account locked.")
+
+// ErrPasswordExpired is returned by Authenticate if the password is expired or
+// must be changed before it can be used.
+var ErrPasswordExpired = errors.New("Password expired.")
+
+// Active Directory reports the reason of a failed bind in the diagnostic message,
+// e.g. "80090308: LdapErr: DSID-0C09042F, comment: AcceptSecurityContext error, data 775, v2580"
+var adBindErrors = map[string]error{
+	"data 52e": ErrInvalidCredentials,
+	"data 530": ErrAccountLocked, // not permitted to logon at this time
+	"data 531": ErrAccountLocked, // not permitted to logon at this workstation
+	"data 532": ErrPasswordExpired,
+	"data 533": ErrAccountLocked,   // account disabled
+	"data 701": ErrAccountLocked,   // account expired
+	"data 773": ErrPasswordExpired, // user must reset password
+	"data 775": ErrAccountLocked,
+}
+
+// bindError maps the error of a failed bind to one of the errors of Authenticate. Errors
+// which aren't caused by the credentials are returned unmodified.
+func bindError(err error) error {
+	code, ok := resultCode(err)
+	if !ok || code != resultInvalidCredentials {
+		return err
+	}
+
+	msg := err.Error()
+	for k, v := range adBindErrors {
+		if strings.Contains(msg, k) {
+			return v
+		}
+	}
+
+	return ErrInvalidCredentials
+}
+
+// Authenticate verifies password by binding as the DN of item. The bind is done on a
+// connection of the Pool of the Manager, so the binding of the Manager's own connection
+// is left intact. After a successful bind, the connection is closed instead of being
+// returned to the Pool.
+//
+// A wrong DN or password is reported as ErrInvalidCredentials, locked accounts and expired
+// passwords as ErrAccountLocked and ErrPasswordExpired if the server tells so, either in
+// the password policy response control or, like Active Directory, in the diagnostic message.
+// Empty passwords are refused with ErrEmptyPassword.
+func (c *Manager) Authenticate(item Item, password string) error {
+	_, err := c.AuthenticatePolicy(item, password)
+	return err
+}
+
+// AuthenticatePolicy works like Authenticate, but sends the password policy request
+// control with the bind and returns the password policy response of the server, if
+// any. The response holds warnings like the time until the password expires.
+//
+// A password which must be changed after a reset is reported as ErrPasswordExpired,
+// although the bind itself succeeded.
+func (c *Manager) AuthenticatePolicy(item Item, password string) (*PasswordPolicy, error) {
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+
+	if c.Pool == nil {
+		return nil, errors.New("Manager has no Pool for authentication.")
+	}
+
+	conn, err := c.Pool.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	bindRequest := ldap.NewSimpleBindRequest(c.appendBaseDn(item.Dn()), password, []ldap.Control{newPasswordPolicyControl()})
+
+	if c.Debug {
+		log.Println("Bind request:", bindRequest.Username)
+	}
+
+	result, err := conn.SimpleBind(bindRequest)
+	if _, ok := resultCode(err); err != nil && !ok {
+		// not an LDAP error, the connection is probably broken
+		c.Pool.Discard(conn)
+		return nil, err
+	}
+
+	// a connection bound as the user mustn't be used by others, after a failed bind
+	// it is anonymous (RFC 4513 section 4)
+	if err == nil {
+		c.Pool.Discard(conn)
+	} else {
+		c.Pool.Put(conn)
+	}
+
+	var policy *PasswordPolicy
+	if result != nil {
+		var perr error
+		policy, perr = parsePasswordPolicy(result.Controls)
+		if perr != nil && err == nil {
+			return nil, perr
+		}
+	}
+
+	if policy != nil {
+		switch policy.Err {
+		case AccountLocked:
+			return policy, ErrAccountLocked
+		case PasswordExpired, ChangeAfterReset:
+			return policy, ErrPasswordExpired
+		}
+	}
+
+	if err != nil {
+		return policy, bindError(err)
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,54 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"log"
+	"strings"
+)
+
+// OIDs of the proxied authorization control (RFC 4370) and the Who am I?
+// extended operation (RFC 4532)
+const (
+	oidProxiedAuthorization = "2.16.840.1.113730.3.4.18"
+	oidWhoAmI               = "1.3.6.1.4.1.4203.1.11.3"
+)
+
+// As returns a Manager performing all operations on behalf of authzId, using the
+// proxied authorization control (RFC 4370). The server applies its access control
+// as if authzId performed the operations, provided the bound user is allowed to
+// proxy (e.g. authzTo in OpenLDAP).
+//
+// authzId is either "dn:<dn>" or "u:<username>", which are used as is, or a DN to
+// which the baseDn is appended like for Items.
+//
+// The returned Manager shares the connection of c.
+func (c *Manager) As(authzId string) *Manager {
+	if !strings.HasPrefix(authzId, "dn:") && !strings.HasPrefix(authzId, "u:") {
+		authzId = "dn:" + c.appendBaseDn(authzId)
+	}
+
+	d := c.derive()
+	d.controls = append(d.controls, ldap.NewControlString(oidProxiedAuthorization, true, authzId))
+	return d
+}
+
+// WhoAmI returns the authorization identity the server uses for the operations of the
+// Manager (RFC 4532), e.g. "dn:cn=admin,dc=example,dc=com". For anonymous connections,
+// the empty string is returned. For Managers returned by As, the identity is the proxied one.
+func (c *Manager) WhoAmI() (string, error) {
+	extendedRequest := &ldap.ExtendedRequest{
+		Name:     oidWhoAmI,
+		Controls: c.requestControls(),
+	}
+
+	if c.Debug {
+		log.Println("Who am I request:", extendedRequest)
+	}
+
+	response, err := c.doExtended(extendedRequest)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Value, nil
+}
@@ -0,0 +1,31 @@
+package crud
+
+import (
+	"testing"
+)
+
+func TestAs(t *testing.T) {
+	c := New(nil, "dc=example,dc=com")
+
+	tests := []struct {
+		authzId  string
+		expected string
+	}{
+		{"sn=Foobar", "dn:sn=Foobar,dc=example,dc=com"},
+		{"dn:cn=admin,dc=example,dc=com", "dn:cn=admin,dc=example,dc=com"},
+		{"u:fritz", "u:fritz"},
+	}
+
+	for _, v := range tests {
+		d := c.As(v.authzId)
+
+		value, ok := findControl(d.requestControls(), oidProxiedAuthorization)
+		if !ok || value != v.expected {
+			t.Error("unexpected proxied authorization for", v.authzId, ":", value)
+		}
+	}
+
+	if len(c.requestControls()) != 0 {
+		t.Error("As modified the original Manager")
+	}
+}
@@ -0,0 +1,176 @@
+package crud
+
+import (
+	"errors"
+)
+
+// Minimal BER encoding and decoding (X.690) of the values of controls and extended
+// operations, which the ldap package passes through as opaque strings.
+
+// BER tags used in LDAP
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+
+	// class and constructed bits for context-specific tags
+	berContext     = 0x80
+	berConstructed = 0x20
+)
+
+var errBerTruncated = errors.New("BER data truncated.")
+
+// berEncode encodes content with tag as BER element
+func berEncode(tag byte, content []byte) []byte {
+	l := len(content)
+
+	var length []byte
+	if l < 0x80 {
+		length = []byte{byte(l)}
+	} else {
+		for ; l > 0; l >>= 8 {
+			length = append([]byte{byte(l)}, length...)
+		}
+		length = append([]byte{0x80 | byte(len(length))}, length...)
+	}
+
+	out := make([]byte, 0, 1+len(length)+len(content))
+	out = append(out, tag)
+	out = append(out, length...)
+	return append(out, content...)
+}
+
+// berEncodeSequence encodes the already encoded elements as sequence with tag
+func berEncodeSequence(tag byte, elements ...[]byte) []byte {
+	var content []byte
+	for _, v := range elements {
+		content = append(content, v...)
+	}
+
+	return berEncode(tag, content)
+}
+
+// berEncodeString encodes s as octet string with tag
+func berEncodeString(tag byte, s string) []byte {
+	return berEncode(tag, []byte(s))
+}
+
+// berEncodeInt encodes i as integer with tag
+func berEncodeInt(tag byte, i int64) []byte {
+	var content []byte
+	for {
+		content = append([]byte{byte(i)}, content...)
+		if (i < 0x80 && i >= -0x80) || len(content) == 8 {
+			break
+		}
+		i >>= 8
+	}
+
+	return berEncode(tag, content)
+}
+
+// berEncodeBool encodes b as boolean with tag
+func berEncodeBool(tag byte, b bool) []byte {
+	if b {
+		return berEncode(tag, []byte{0xff})
+	}
+	return berEncode(tag, []byte{0x00})
+}
+
+// A berElement is a decoded BER element. Constructed elements can be decoded further
+// with children.
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+// berDecode decodes the first BER element of data and returns it together with the
+// remaining data.
+func berDecode(data []byte) (berElement, []byte, error) {
+	if len(data) < 2 {
+		return berElement{}, nil, errBerTruncated
+	}
+
+	tag := data[0]
+	l := int(data[1])
+	data = data[2:]
+
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 4 || len(data) < n {
+			return berElement{}, nil, errors.New("Invalid BER length.")
+		}
+
+		l = 0
+		for _, v := range data[:n] {
+			l = l<<8 | int(v)
+		}
+		data = data[n:]
+	}
+
+	if l > len(data) {
+		return berElement{}, nil, errBerTruncated
+	}
+
+	return berElement{tag: tag, content: data[:l]}, data[l:], nil
+}
+
+// berDecodeSingle decodes data, which must be a single BER element
+func berDecodeSingle(data []byte) (berElement, error) {
+	e, rest, err := berDecode(data)
+	if err != nil {
+		return e, err
+	}
+
+	if len(rest) != 0 {
+		return e, errors.New("Trailing data after BER element.")
+	}
+
+	return e, nil
+}
+
+// children decodes the content of a constructed element
+func (e berElement) children() ([]berElement, error) {
+	var children []berElement
+
+	data := e.content
+	for len(data) > 0 {
+		var child berElement
+		var err error
+
+		child, data, err = berDecode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		children = append(children, child)
+	}
+
+	return children, nil
+}
+
+// int returns the content of an integer or enumerated element
+func (e berElement) int() int64 {
+	var i int64
+	for n, v := range e.content {
+		if n == 0 && v&0x80 != 0 {
+			i = -1
+		}
+		i = i<<8 | int64(v)
+	}
+
+	return i
+}
+
+// bool returns the content of a boolean element
+func (e berElement) bool() bool {
+	return len(e.content) > 0 && e.content[0] != 0
+}
+
+// string returns the content of an octet string element
+func (e berElement) string() string {
+	return string(e.content)
+}
@@ -0,0 +1,65 @@
+package crud
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBerRoundtrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+
+	data := berEncodeSequence(berSequence,
+		berEncodeString(berOctetString, "foo"),
+		berEncodeInt(berInteger, 1500),
+		berEncodeInt(berEnumerated, -2),
+		berEncodeBool(berBoolean, true),
+		berEncodeString(berContext|0, long))
+
+	e, err := berDecodeSingle(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	children, err := e.children()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 5 {
+		t.Fatal("Expected exactly five elements, got", len(children))
+	}
+
+	if children[0].tag != berOctetString || children[0].string() != "foo" {
+		t.Error("unexpected octet string:", children[0])
+	}
+
+	if children[1].int() != 1500 || children[2].int() != -2 || !children[3].bool() {
+		t.Error("unexpected values:", children[1].int(), children[2].int(), children[3].bool())
+	}
+
+	if children[4].tag != berContext || children[4].string() != long {
+		t.Error("unexpected long string with tag", children[4].tag)
+	}
+}
+
+func TestBerEncode(t *testing.T) {
+	// example from RFC 3062: userIdentity and newPasswd
+	data := berEncodeSequence(berSequence,
+		berEncodeString(berContext|0, "uid=a"),
+		berEncodeString(berContext|2, "pw"))
+
+	expected := []byte{0x30, 0x0b, 0x80, 0x05, 'u', 'i', 'd', '=', 'a', 0x82, 0x02, 'p', 'w'}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("unexpected encoding: % x", data)
+	}
+
+	if !bytes.Equal(berEncodeInt(berInteger, 128), []byte{0x02, 0x02, 0x00, 0x80}) {
+		t.Errorf("unexpected integer encoding: % x", berEncodeInt(berInteger, 128))
+	}
+
+	_, err := berDecodeSingle([]byte{0x04, 0x05, 'a'})
+	if err == nil {
+		t.Error("truncated data was decoded")
+	}
+}
@@ -0,0 +1,212 @@
+package crud
+
+import (
+	"errors"
+	"github.com/rbns/ldap"
+	"sync"
+	"time"
+)
+
+// BulkOptions configure bulk operations.
+type BulkOptions struct {
+	// Number of Items processed in parallel, at least 1. Only a single worker is used
+	// if Pool isn't set.
+	Workers int
+
+	// Maximum number of Items processed per second by all workers together, no limit
+	// if 0 or more than one per nanosecond
+	Rate int
+
+	// Pool each worker takes a connection of its own from. If nil, a single worker uses
+	// the connection of the Manager. The Pool of the Manager isn't used, as its
+	// connections aren't bound.
+	Pool *Pool
+
+	// Called for every connection taken from the Pool before using it, e.g. to bind it.
+	// Connections bound by it are closed after use instead of being returned to the Pool.
+	Bind func(conn *ldap.Connection) error
+}
+
+// A BulkResult is the result of a bulk operation for a single Item.
+type BulkResult struct {
+	// Position of the Item in the input
+	Index int
+
+	Item Item
+
+	// Error of the operation, nil if it succeeded
+	Err error
+}
+
+// bulkJob is an Item to process with its position in the input
+type bulkJob struct {
+	index int
+	item  Item
+}
+
+// BulkCreate creates items like Create in parallel as configured by options, which may be
+// nil. All items are processed, regardless of errors, and the result of every Item is
+// returned in the order of items.
+func (c *Manager) BulkCreate(items []Item, options *BulkOptions) []BulkResult {
+	return c.bulkSlice(OperationCreate, items, options)
+}
+
+// BulkUpdate updates items like Update, see BulkCreate.
+func (c *Manager) BulkUpdate(items []Item, options *BulkOptions) []BulkResult {
+	return c.bulkSlice(OperationUpdate, items, options)
+}
+
+// BulkDelete deletes items like Delete, see BulkCreate.
+func (c *Manager) BulkDelete(items []Item, options *BulkOptions) []BulkResult {
+	return c.bulkSlice(OperationDelete, items, options)
+}
+
+// Bulk does op, which must be OperationCreate, OperationUpdate or OperationDelete, for
+// all Items received from items until it is closed, in parallel as configured by options,
+// which may be nil. The results are sent in the order the operations finish, the
+// channel is closed after the last one. It must be read until then.
+//
+// In dry run mode, a single worker is used, as the LDIF Writer isn't safe for concurrent
+// use.
+func (c *Manager) Bulk(op Operation, items <-chan Item, options *BulkOptions) <-chan BulkResult {
+	results := make(chan BulkResult)
+	go c.bulk(op, items, options, results)
+	return results
+}
+
+// bulkSlice does a bulk operation for a slice of Items
+func (c *Manager) bulkSlice(op Operation, items []Item, options *BulkOptions) []BulkResult {
+	input := make(chan Item)
+	go func() {
+		for _, v := range items {
+			input <- v
+		}
+		close(input)
+	}()
+
+	results := make([]BulkResult, len(items))
+	for r := range c.Bulk(op, input, options) {
+		results[r.Index] = r
+	}
+
+	return results
+}
+
+// bulk distributes items to the workers and closes results when all are done
+func (c *Manager) bulk(op Operation, items <-chan Item, options *BulkOptions, results chan<- BulkResult) {
+	if options == nil {
+		options = &BulkOptions{}
+	}
+
+	// without a Pool, all workers would share the connection of the Manager
+	workers := options.Workers
+	if workers < 1 || options.Pool == nil || c.dryRun != nil {
+		workers = 1
+	}
+
+	// higher rates than one per nanosecond can't be limited by a ticker
+	var ticker *time.Ticker
+	if options.Rate > 0 && time.Duration(options.Rate) <= time.Second {
+		ticker = time.NewTicker(time.Second / time.Duration(options.Rate))
+		defer ticker.Stop()
+	}
+
+	jobs := make(chan bulkJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.bulkWorker(op, options.Pool, options.Bind, ticker, jobs, results)
+		}()
+	}
+
+	index := 0
+	for v := range items {
+		jobs <- bulkJob{index: index, item: v}
+		index++
+	}
+	close(jobs)
+
+	wg.Wait()
+	close(results)
+}
+
+// bulkWorker processes jobs until there are no more, using a connection of pool if
+// it isn't nil
+func (c *Manager) bulkWorker(op Operation, pool *Pool, bind func(*ldap.Connection) error, ticker *time.Ticker, jobs <-chan bulkJob, results chan<- BulkResult) {
+	var m *Manager
+	if pool == nil || c.dryRun != nil {
+		m = c
+	}
+
+	defer func() {
+		if m == nil || m == c {
+			return
+		}
+
+		// connections bound by bind mustn't be used by other users of the Pool
+		if bind != nil {
+			pool.Discard(m.conn)
+		} else {
+			pool.Put(m.conn)
+		}
+	}()
+
+	for job := range jobs {
+		if ticker != nil {
+			<-ticker.C
+		}
+
+		var err error
+		if m == nil {
+			m, err = c.bulkManager(pool, bind)
+		}
+
+		if err == nil {
+			err = m.bulkDo(op, job.item)
+
+			// not an LDAP error, the connection is probably broken
+			if _, ok := resultCode(err); err != nil && !ok && m != c {
+				pool.Discard(m.conn)
+				m = nil
+			}
+		}
+
+		results <- BulkResult{Index: job.index, Item: job.item, Err: err}
+	}
+}
+
+// bulkManager returns a Manager derived from c using a connection of pool
+func (c *Manager) bulkManager(pool *Pool, bind func(*ldap.Connection) error) (*Manager, error) {
+	conn, err := pool.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	if bind != nil {
+		err = bind(conn)
+		if err != nil {
+			pool.Discard(conn)
+			return nil, err
+		}
+	}
+
+	m := c.derive()
+	m.conn = conn
+	return m, nil
+}
+
+// bulkDo does op for item
+func (c *Manager) bulkDo(op Operation, item Item) error {
+	switch op {
+	case OperationCreate:
+		return c.Create(item)
+	case OperationUpdate:
+		return c.Update(item)
+	case OperationDelete:
+		return c.Delete(item)
+	}
+
+	return errors.New("Unsupported bulk operation.")
+}
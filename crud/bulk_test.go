@@ -0,0 +1,118 @@
+package crud
+
+import (
+	"errors"
+	"github.com/rbns/ldap"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulk(t *testing.T) {
+	errExists := &ldap.Error{ResultCode: resultUnwillingToPerform}
+
+	var mutex sync.Mutex
+	var running, maxRunning int
+
+	// simulate a server refusing to create ou=c, the third item
+	server := func(inv *Invocation, next Handler) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		if inv.Dn == "ou=c" {
+			return errExists
+		}
+
+		return nil
+	}
+
+	// the connections are never used, as the interceptor answers all requests
+	dialed := 0
+	pool := NewPool(func() (*ldap.Connection, error) {
+		mutex.Lock()
+		dialed++
+		mutex.Unlock()
+
+		return new(ldap.Connection), nil
+	}, 4)
+
+	c := New(nil, "").WithInterceptors(server)
+
+	items := make([]Item, 8)
+	for i := range items {
+		name := string('a' + rune(i))
+		items[i] = &OrganizationalUnit{dn: "ou=" + name, ou: []string{name}}
+	}
+
+	results := c.BulkCreate(items, &BulkOptions{Workers: 4, Pool: pool})
+	if len(results) != len(items) {
+		t.Fatal("expected a result for every item, got", len(results))
+	}
+
+	for i, v := range results {
+		if v.Index != i || v.Item != items[i] {
+			t.Errorf("unexpected result %d: %+v", i, v)
+		}
+
+		if (i == 2) != (v.Err == errExists) {
+			t.Errorf("unexpected error for item %d: %v", i, v.Err)
+		}
+	}
+
+	if maxRunning < 2 || maxRunning > 4 {
+		t.Error("expected up to 4 parallel operations, got", maxRunning)
+	}
+
+	if dialed < 2 || dialed > 4 || len(pool.idle) != dialed {
+		t.Errorf("expected the %d connections used to be put back, %d are idle", dialed, len(pool.idle))
+	}
+
+	// 8 items at 100 per second take at least 70ms
+	start := time.Now()
+	results = c.BulkDelete(items, &BulkOptions{Workers: 4, Pool: pool, Rate: 100})
+	if d := time.Since(start); d < 70*time.Millisecond {
+		t.Error("expected rate limiting, took", d)
+	}
+
+	if len(results) != len(items) || results[2].Err != errExists {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	// without a Pool in the options, the connection of the Manager is used by a single
+	// worker, not the unbound connections of its Pool
+	c.Pool = NewPool(func() (*ldap.Connection, error) {
+		t.Error("unexpected connection to the Pool of the Manager")
+		return nil, errors.New("unexpected dial")
+	}, 4)
+
+	maxRunning = 0
+	results = c.BulkCreate(items, nil)
+	if len(results) != len(items) || results[2].Err != errExists {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	if maxRunning != 1 {
+		t.Error("expected a single worker without a pool, got", maxRunning)
+	}
+
+	// no rate limiting above one item per nanosecond
+	results = c.BulkDelete(items, &BulkOptions{Rate: 2000000000})
+	if len(results) != len(items) {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	results = c.BulkUpdate(nil, nil)
+	if len(results) != 0 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
@@ -0,0 +1,375 @@
+package crud
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/rbns/ldap"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Cache wraps a Manager and caches the results of Read, ReadAll and ReadAllRegistry. Read
+// results are cached by normalized DN, ReadAll results by base, scope and filter, both with
+// the requested attributes. Cached results are invalidated by the writes done with the
+// Manager and the Managers derived from it afterwards, including password changes, but not
+// by writes done otherwise, e.g. by other clients.
+//
+// As results depend on the access rights of the bound user, a Cache should only be used
+// with a single identity.
+type Cache struct {
+	// Time results are cached for Items of types without a TTL set with SetTTL
+	DefaultTTL time.Duration
+
+	// Maximum estimated size of the cached entries in bytes, the least recently used
+	// results are removed to stay below it. No limit if 0.
+	MaxSize int
+
+	manager *Manager
+	ttls    map[reflect.Type]time.Duration
+
+	mutex   sync.Mutex
+	size    int
+	lru     *list.List
+	results map[string]*list.Element
+
+	// incremented by every invalidation, to not cache results read before it
+	generation uint64
+
+	// clock, replaced in tests
+	now func() time.Time
+}
+
+// cacheResult is a cached result of a Read or ReadAll
+type cacheResult struct {
+	key     string
+	entries []*ldap.Entry
+	expires time.Time
+	size    int
+
+	// normalized base and scope of the search, for invalidating
+	base  string
+	scope Scope
+}
+
+// NewCache creates a Cache for m caching results for a minute by default. It adds an
+// Interceptor to m invalidating the results affected by its writes, so m mustn't be in
+// use by other goroutines meanwhile.
+func NewCache(m *Manager) *Cache {
+	c := &Cache{
+		DefaultTTL: time.Minute,
+		manager:    m,
+		ttls:       make(map[reflect.Type]time.Duration),
+		lru:        list.New(),
+		results:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+
+	if m != nil {
+		m.interceptors = append(m.interceptors, c.intercept)
+	}
+
+	return c
+}
+
+// SetTTL sets the time results are cached for Items of the same type as item. A TTL
+// of 0 disables caching for the type.
+func (c *Cache) SetTTL(item Item, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ttls[reflect.TypeOf(item)] = ttl
+}
+
+// Manager returns the wrapped Manager.
+func (c *Cache) Manager() *Manager {
+	return c.manager
+}
+
+// Create creates item like Manager.Create.
+func (c *Cache) Create(item Item) error {
+	return c.manager.Create(item)
+}
+
+// Read reads item from the cache or like Manager.Read.
+func (c *Cache) Read(item Item) error {
+	base := normalizeDn(item.Dn())
+	key := "read\x00" + base + "\x00" + c.attributesKey()
+
+	entries, generation, ok := c.get(key)
+	if !ok {
+		entry, err := c.manager.readEntry(item)
+		if err != nil {
+			return err
+		}
+
+		entries = []*ldap.Entry{entry}
+		c.put(item, &cacheResult{key: key, entries: entries, base: base, scope: ScopeBaseObject}, generation)
+	}
+
+	return unmarshal(item, copyEntry(entries[0]))
+}
+
+// ReadAll searches the cache or like Manager.ReadAll.
+func (c *Cache) ReadAll(item Item, dn string, scope Scope, filter string, args ...interface{}) ([]Item, error) {
+	entries, err := c.search(item, dn, scope, filter, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, len(entries))
+	for i, v := range entries {
+		items[i] = item.Copy()
+		err := unmarshal(items[i], copyEntry(v))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+// ReadAllRegistry searches the cache or like Manager.ReadAllRegistry. The results are
+// cached with the DefaultTTL.
+func (c *Cache) ReadAllRegistry(r *Registry, dn string, scope Scope, filter string, args ...interface{}) ([]Item, error) {
+	entries, err := c.search(nil, dn, scope, filter, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(entries))
+	for _, v := range entries {
+		item, err := r.unmarshal(copyEntry(v))
+		if err != nil {
+			return nil, err
+		}
+
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// ReadAllRegistrySubtree is like Manager.ReadAllRegistrySubtree, using the cache.
+func (c *Cache) ReadAllRegistrySubtree(r *Registry, dn string) ([]Item, error) {
+	return c.ReadAllRegistry(r, dn, ScopeWholeSubtree, strings.Replace(r.Filter(), "%", "%%", -1))
+}
+
+// ReadAllSiblings is like Manager.ReadAllSiblings, using the cache.
+func (c *Cache) ReadAllSiblings(item Item) ([]Item, error) {
+	return c.ReadAll(item, parentDn(item.Dn()), ScopeSingleLevel, "(objectClass=%v)", item.FilterObjectClass())
+}
+
+// ReadAllSubtree is like Manager.ReadAllSubtree, using the cache.
+func (c *Cache) ReadAllSubtree(item Item) ([]Item, error) {
+	return c.ReadAll(item, parentDn(item.Dn()), ScopeWholeSubtree, "(objectClass=%v)", item.FilterObjectClass())
+}
+
+// search returns the entries of a search from the cache or from the server
+func (c *Cache) search(item Item, dn string, scope Scope, filter string, args ...interface{}) ([]*ldap.Entry, error) {
+	base := normalizeDn(dn)
+	key := fmt.Sprintf("search\x00%v\x00%d\x00%v\x00%v", base, scope, formatFilter(filter, args...), c.attributesKey())
+
+	entries, generation, ok := c.get(key)
+	if !ok {
+		var err error
+		entries, err = c.manager.search(item, dn, scope, filter, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		c.put(item, &cacheResult{key: key, entries: entries, base: base, scope: scope}, generation)
+	}
+
+	return entries, nil
+}
+
+// attributesKey returns the attributes the Manager requests as part of a cache key
+func (c *Cache) attributesKey() string {
+	attrs := append([]string{}, c.manager.attributes()...)
+	for i, v := range attrs {
+		attrs[i] = strings.ToLower(v)
+	}
+	sort.Strings(attrs)
+
+	return strings.Join(attrs, ",")
+}
+
+// Update updates item like Manager.Update, reading the old values from the server.
+func (c *Cache) Update(item Item) error {
+	return c.manager.Update(item)
+}
+
+// Delete deletes item like Manager.Delete.
+func (c *Cache) Delete(item Item) error {
+	return c.manager.Delete(item)
+}
+
+// DeleteSubtree deletes the subtree of item like Manager.DeleteSubtree.
+func (c *Cache) DeleteSubtree(item Item) error {
+	return c.manager.DeleteSubtree(item)
+}
+
+// Passwd changes the password like Manager.Passwd.
+func (c *Cache) Passwd(item Item, passwd string) error {
+	return c.manager.Passwd(item, passwd)
+}
+
+// PasswdModify changes the password like Manager.PasswdModify.
+func (c *Cache) PasswdModify(item Item, oldPasswd, newPasswd string) (string, error) {
+	return c.manager.PasswdModify(item, oldPasswd, newPasswd)
+}
+
+// intercept invalidates the results affected by a successful write of the Manager. If
+// the password of the bound user is changed, its DN isn't known, so all results are
+// removed.
+func (c *Cache) intercept(inv *Invocation, next Handler) error {
+	err := next(inv)
+	if err != nil {
+		return err
+	}
+
+	dn := inv.Manager.removeBaseDn(inv.Dn)
+	switch inv.Operation {
+	case OperationCreate, OperationUpdate, OperationDelete:
+		c.Invalidate(dn)
+	case OperationDeleteSubtree:
+		c.InvalidateSubtree(dn)
+	case OperationRename:
+		modifyDNRequest := inv.Request.(*ldap.ModifyDNRequest)
+		superior := parentDn(dn)
+		if modifyDNRequest.NewSuperior != "" {
+			superior = inv.Manager.removeBaseDn(modifyDNRequest.NewSuperior)
+		}
+
+		c.InvalidateSubtree(dn)
+		c.InvalidateSubtree(modifyDNRequest.NewRDN + "," + superior)
+	case OperationPasswd:
+		if inv.Item == nil {
+			c.Purge()
+		} else {
+			c.Invalidate(dn)
+		}
+	}
+
+	return nil
+}
+
+// Invalidate removes all results which could contain the entry with dn.
+func (c *Cache) Invalidate(dn string) {
+	dn = normalizeDn(dn)
+
+	c.invalidate(func(r *cacheResult) bool {
+		return inScope(dn, r.base, r.scope)
+	})
+}
+
+// InvalidateSubtree removes all results which could contain entries below dn.
+func (c *Cache) InvalidateSubtree(dn string) {
+	dn = normalizeDn(dn)
+
+	c.invalidate(func(r *cacheResult) bool {
+		return inScope(r.base, dn, ScopeWholeSubtree) || inScope(dn, r.base, r.scope)
+	})
+}
+
+// Purge removes all results.
+func (c *Cache) Purge() {
+	c.invalidate(func(*cacheResult) bool {
+		return true
+	})
+}
+
+// invalidate removes all results for which affected returns true
+func (c *Cache) invalidate(affected func(*cacheResult) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	for _, v := range c.results {
+		if affected(v.Value.(*cacheResult)) {
+			c.remove(v)
+		}
+	}
+}
+
+// get returns the cached entries for key if they haven't expired, and the current
+// generation to pass to put otherwise
+func (c *Cache) get(key string) ([]*ldap.Entry, uint64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.results[key]
+	if !ok {
+		return nil, c.generation, false
+	}
+
+	result := e.Value.(*cacheResult)
+	if !c.now().Before(result.expires) {
+		c.remove(e)
+		return nil, c.generation, false
+	}
+
+	c.lru.MoveToFront(e)
+	return result.entries, c.generation, true
+}
+
+// put caches result with the TTL of the type of item, unless there was an invalidation
+// since generation
+func (c *Cache) put(item Item, result *cacheResult, generation uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	ttl, ok := c.ttls[reflect.TypeOf(item)]
+	if !ok {
+		ttl = c.DefaultTTL
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	result.expires = c.now().Add(ttl)
+	for _, v := range result.entries {
+		result.size += entrySize(v)
+	}
+
+	if e, ok := c.results[result.key]; ok {
+		c.remove(e)
+	}
+
+	c.results[result.key] = c.lru.PushFront(result)
+	c.size += result.size
+
+	for c.MaxSize > 0 && c.size > c.MaxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes a result, the mutex must be held
+func (c *Cache) remove(e *list.Element) {
+	result := c.lru.Remove(e).(*cacheResult)
+	delete(c.results, result.key)
+	c.size -= result.size
+}
+
+// entrySize estimates the memory used by e
+func entrySize(e *ldap.Entry) int {
+	size := len(e.DN)
+	for _, a := range e.Attributes {
+		size += len(a.Name)
+		for _, v := range a.Values {
+			size += len(v)
+		}
+	}
+
+	return size
+}
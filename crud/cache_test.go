@@ -0,0 +1,253 @@
+package crud
+
+import (
+	"bytes"
+	"errors"
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+	"testing"
+	"time"
+)
+
+// cacheEntry returns an entry of about size bytes
+func cacheEntry(dn string, size int) []*ldap.Entry {
+	entry := ldap.NewEntry(dn)
+	entry.AddAttributeValue("description", string(make([]byte, size-len(dn)-len("description"))))
+	return []*ldap.Entry{entry}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Now()
+	c := NewCache(nil)
+	c.now = func() time.Time { return now }
+	c.SetTTL(&Dynamic{}, time.Second)
+	c.SetTTL(&OrganizationalUnit{}, 0)
+
+	c.put(&Dynamic{}, &cacheResult{key: "a", entries: cacheEntry("ou=a", 100)}, 0)
+	c.put(&OrganizationalUnit{}, &cacheResult{key: "b", entries: cacheEntry("ou=b", 100)}, 0)
+
+	if _, _, ok := c.get("a"); !ok {
+		t.Error("expected cached result")
+	}
+
+	if _, _, ok := c.get("b"); ok {
+		t.Error("expected no result for type with TTL 0")
+	}
+
+	now = now.Add(time.Second)
+	if _, _, ok := c.get("a"); ok {
+		t.Error("expected result to be expired")
+	}
+
+	if c.size != 0 || len(c.results) != 0 {
+		t.Error("expired result not removed:", c.size, len(c.results))
+	}
+}
+
+func TestCacheMaxSize(t *testing.T) {
+	c := NewCache(nil)
+	c.MaxSize = 250
+
+	c.put(&Dynamic{}, &cacheResult{key: "a", entries: cacheEntry("ou=a", 100)}, 0)
+	c.put(&Dynamic{}, &cacheResult{key: "b", entries: cacheEntry("ou=b", 100)}, 0)
+
+	// a is used more recently than b now
+	c.get("a")
+	c.put(&Dynamic{}, &cacheResult{key: "c", entries: cacheEntry("ou=c", 100)}, 0)
+
+	if _, _, ok := c.get("b"); ok {
+		t.Error("expected least recently used result to be removed")
+	}
+
+	if _, _, ok := c.get("a"); !ok {
+		t.Error("expected recently used result to be kept")
+	}
+
+	if c.size != 200 {
+		t.Error("unexpected size:", c.size)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	c := NewCache(nil)
+
+	results := []*cacheResult{
+		{key: "read", base: "ou=a,ou=b", scope: ScopeBaseObject},
+		{key: "one", base: "ou=b", scope: ScopeSingleLevel},
+		{key: "sub", base: "", scope: ScopeWholeSubtree},
+		{key: "other", base: "ou=c", scope: ScopeWholeSubtree},
+		{key: "below", base: "ou=d,ou=a,ou=b", scope: ScopeBaseObject},
+	}
+
+	for _, v := range results {
+		c.put(&Dynamic{}, v, 0)
+	}
+
+	_, generation, _ := c.get("read")
+
+	c.Invalidate("OU=A, ou=B")
+	for _, v := range []string{"read", "one", "sub"} {
+		if _, _, ok := c.get(v); ok {
+			t.Error("expected result to be invalidated:", v)
+		}
+	}
+
+	for _, v := range []string{"other", "below"} {
+		if _, _, ok := c.get(v); !ok {
+			t.Error("expected result to be kept:", v)
+		}
+	}
+
+	c.InvalidateSubtree("ou=a,ou=b")
+	if _, _, ok := c.get("below"); ok {
+		t.Error("expected result below deleted subtree to be invalidated")
+	}
+
+	// results read before an invalidation aren't cached
+	c.put(&Dynamic{}, &cacheResult{key: "read", base: "ou=a,ou=b"}, generation)
+	if _, _, ok := c.get("read"); ok {
+		t.Error("expected stale result not to be cached")
+	}
+}
+
+func TestCacheReadAllRegistry(t *testing.T) {
+	var searches int
+	m := New(nil, "dc=example,dc=com")
+	c := NewCache(m)
+
+	// answer all operations behind the interceptor of the Cache
+	c.manager = m.WithInterceptors(func(inv *Invocation, next Handler) error {
+		switch inv.Operation {
+		case OperationReadAll:
+			searches++
+			entry := ldap.NewEntry("ou=people")
+			entry.AddAttributeValue("objectClass", "organizationalUnit")
+			entry.AddAttributeValue("ou", "people")
+			inv.Entries = []*ldap.Entry{entry}
+		}
+
+		return nil
+	})
+
+	r := NewRegistry()
+	r.Register(&OrganizationalUnit{})
+
+	for i := 0; i < 2; i++ {
+		items, err := c.ReadAllRegistrySubtree(r, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(items) != 1 || items[0].(*OrganizationalUnit).ou[0] != "people" {
+			t.Error("unexpected items:", items)
+		}
+	}
+
+	if searches != 1 {
+		t.Error("expected a single search, got", searches)
+	}
+
+	// password changes invalidate the results
+	err := c.Passwd(&OrganizationalUnit{dn: "ou=people"}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.ReadAllRegistrySubtree(r, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if searches != 2 {
+		t.Error("expected results to be invalidated by the password change")
+	}
+}
+
+func TestCacheAttributesKey(t *testing.T) {
+	c := NewCache(New(nil, ""))
+	o := NewCache(New(nil, "").WithOperationalAttributes())
+
+	if c.attributesKey() == o.attributesKey() {
+		t.Error("expected different keys for different attributes:", c.attributesKey())
+	}
+}
+
+// movedUser is created below ou=people by its BeforeCreate hook
+type movedUser struct {
+	*Dynamic
+}
+
+func (u *movedUser) Copy() Item {
+	return &movedUser{Dynamic: u.Dynamic.Copy().(*Dynamic)}
+}
+
+func (u *movedUser) BeforeCreate() error {
+	u.SetDn(u.Dn() + ",ou=people")
+	return nil
+}
+
+func TestCacheManagerWrites(t *testing.T) {
+	var b bytes.Buffer
+	var reads int
+	m := New(nil, "dc=example,dc=com").DryRun(ldif.NewWriter(&b)).WithInterceptors(func(inv *Invocation, next Handler) error {
+		if inv.Operation != OperationRead {
+			return next(inv)
+		}
+
+		reads++
+		entry := ldap.NewEntry(inv.Dn)
+		entry.AddAttributeValue("objectClass", "inetOrgPerson")
+		inv.Entries = []*ldap.Entry{entry}
+		return nil
+	})
+	c := NewCache(m)
+
+	read := func() {
+		err := c.Read(NewDynamic("uid=fritz,ou=people"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read()
+	read()
+	if reads != 1 {
+		t.Fatal("expected a single read, got", reads)
+	}
+
+	// the DN set by the hook is invalidated, for writes done with the Manager as well
+	err := m.Create(&movedUser{Dynamic: NewDynamic("uid=fritz")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read()
+	if reads != 2 {
+		t.Error("expected the result to be invalidated by the create")
+	}
+
+	// failed writes don't invalidate
+	failing := m.WithInterceptors(func(inv *Invocation, next Handler) error {
+		return errors.New("failed")
+	})
+
+	err = failing.Delete(NewDynamic("uid=fritz,ou=people"))
+	if err == nil {
+		t.Fatal("expected the delete to fail")
+	}
+
+	read()
+	if reads != 2 {
+		t.Error("expected the result to be kept after a failed delete")
+	}
+
+	err = c.Manager().Delete(NewDynamic("uid=fritz,ou=people"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read()
+	if reads != 3 {
+		t.Error("expected the result to be invalidated by the delete")
+	}
+}
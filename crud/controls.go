@@ -0,0 +1,140 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"sync"
+)
+
+// OIDs of common controls without special support in the Manager. They can be sent
+// with WithControls.
+const (
+	// ManageDsaIT (RFC 3296): treat referral objects as normal entries
+	OIDManageDsaIT = "2.16.840.1.113730.3.4.2"
+
+	// Relax Rules (draft-zeilenga-ldap-relax): allow modifying e.g. NO-USER-MODIFICATION attributes
+	OIDRelax = "1.3.6.1.4.1.4203.666.5.12"
+
+	// Don't Use Copy (RFC 6171): don't answer from a copy like a replica
+	OIDDontUseCopy = "1.3.6.1.1.22"
+
+	// Subentries (RFC 3672): return subentries instead of normal entries, see NewSubentriesControl
+	OIDSubentries = "1.3.6.1.4.1.4203.1.10.1"
+
+	// No-Op (draft-zeilenga-ldap-noop): perform the checks of an update without applying it
+	OIDNoOp = "1.3.6.1.4.1.4203.1.10.2"
+)
+
+// A Control is a request or response control of an LDAP operation (RFC 4511 section 4.1.11).
+type Control struct {
+	// Type of the control
+	OID string
+
+	// If true, the server must refuse the operation if it doesn't support the control
+	Criticality bool
+
+	// BER encoded value of the control, empty if the control has no value
+	Value string
+}
+
+// NewSubentriesControl returns a Subentries control. If visible is true, only subentries
+// are returned by searches, otherwise only normal entries.
+func NewSubentriesControl(visible bool) Control {
+	return Control{OID: OIDSubentries, Criticality: true, Value: string(berEncodeBool(berBoolean, visible))}
+}
+
+// ldapControl converts the Control to an ldap.Control
+func (c Control) ldapControl() ldap.Control {
+	return ldap.NewControlString(c.OID, c.Criticality, c.Value)
+}
+
+// newControl converts an ldap.Control to a Control
+func newControl(control ldap.Control) Control {
+	if c, ok := control.(*ldap.ControlString); ok {
+		return Control{OID: c.ControlType, Criticality: c.Criticality, Value: c.ControlValue}
+	}
+
+	return Control{OID: control.GetControlType()}
+}
+
+// WithControls returns a Manager sending controls with every request, in addition to the
+// controls the Manager sends anyway. The returned Manager shares the connection of c.
+func (c *Manager) WithControls(controls ...Control) *Manager {
+	d := c.derive()
+	for _, v := range controls {
+		d.controls = append(d.controls, v.ldapControl())
+	}
+
+	return d
+}
+
+// WithResponseControls returns a Manager storing the response controls of every
+// response in controls. For operations consisting of several requests, like Update,
+// the controls of the last response are stored. The returned Manager shares the
+// connection of c.
+//
+// Managers derived from the returned one store to controls as well. The stores are
+// synchronized, so they may be used concurrently, but controls must only be read when
+// no operation is running.
+func (c *Manager) WithResponseControls(controls *[]Control) *Manager {
+	d := c.derive()
+	d.responseControls = &responseControls{controls: controls}
+	return d
+}
+
+// responseControls is where a Manager and the Managers derived from it store the
+// response controls
+type responseControls struct {
+	mutex    sync.Mutex
+	controls *[]Control
+}
+
+// setResponseControls stores controls if the Manager collects response controls
+func (c *Manager) setResponseControls(controls []ldap.Control) {
+	if c.responseControls == nil {
+		return
+	}
+
+	response := make([]Control, len(controls))
+	for i, v := range controls {
+		response[i] = newControl(v)
+	}
+
+	c.responseControls.mutex.Lock()
+	*c.responseControls.controls = response
+	c.responseControls.mutex.Unlock()
+}
+
+// derive returns a copy of the Manager sharing its connection, to be modified
+// by methods returning Managers with different settings. Closing a derived
+// Manager closes the shared connection.
+func (c *Manager) derive() *Manager {
+	d := *c
+	d.controls = append([]ldap.Control{}, c.controls...)
+	d.interceptors = append([]Interceptor{}, c.interceptors...)
+	return &d
+}
+
+// requestControls returns the controls to send with every request of the Manager,
+// followed by extra.
+func (c *Manager) requestControls(extra ...ldap.Control) []ldap.Control {
+	controls := make([]ldap.Control, 0, len(c.controls)+len(extra))
+	controls = append(controls, c.controls...)
+	return append(controls, extra...)
+}
+
+// findControl returns the value of the control with the given oid in controls.
+func findControl(controls []ldap.Control, oid string) (string, bool) {
+	for _, v := range controls {
+		if v.GetControlType() != oid {
+			continue
+		}
+
+		if c, ok := v.(*ldap.ControlString); ok {
+			return c.ControlValue, true
+		}
+
+		return "", true
+	}
+
+	return "", false
+}
@@ -0,0 +1,55 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"sync"
+	"testing"
+)
+
+func TestWithControls(t *testing.T) {
+	c := New(nil, "dc=example,dc=com")
+
+	d := c.WithControls(Control{OID: OIDManageDsaIT, Criticality: true}, NewSubentriesControl(true))
+	if len(c.requestControls()) != 0 {
+		t.Error("WithControls modified the original Manager")
+	}
+
+	controls := d.As("sn=Foobar").requestControls()
+	if len(controls) != 3 {
+		t.Fatal("Expected exactly three controls, got", len(controls))
+	}
+
+	subentries := newControl(controls[1])
+	if subentries.OID != OIDSubentries || !subentries.Criticality || subentries.Value != "\x01\x01\xff" {
+		t.Error("unexpected subentries control:", subentries)
+	}
+
+	if controls[2].GetControlType() != oidProxiedAuthorization {
+		t.Error("unexpected control:", controls[2])
+	}
+}
+
+func TestWithResponseControls(t *testing.T) {
+	var response []Control
+	c := New(nil, "dc=example,dc=com").WithResponseControls(&response)
+
+	c.setResponseControls([]ldap.Control{ldap.NewControlString(OIDNoOp, false, "")})
+	if len(response) != 1 || response[0].OID != OIDNoOp {
+		t.Error("unexpected response controls:", response)
+	}
+
+	// derived Managers may store concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(d *Manager) {
+			defer wg.Done()
+			d.setResponseControls([]ldap.Control{ldap.NewControlString(OIDRelax, false, "")})
+		}(c.WithControls())
+	}
+	wg.Wait()
+
+	if len(response) != 1 || response[0].OID != OIDRelax {
+		t.Error("unexpected response controls:", response)
+	}
+}
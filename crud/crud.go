@@ -3,6 +3,7 @@ package crud
 import (
 	"errors"
 	"fmt"
+	"github.com/bytemine/ldap-crud/ldif"
 	"github.com/rbns/ldap"
 	"log"
 	"strings"
@@ -42,11 +43,56 @@ type Manager struct {
 	// Debug mode flag
 	Debug bool
 
+	// Pool of connections for operations which must not change the binding of the
+	// Manager's connection, like Authenticate.
+	Pool *Pool
+
+	// Attributes with more values than this are modified by adding and deleting
+	// single values instead of replacing all values, e.g. members of huge groups.
+	MaxReplaceValues int
+
+	// If greater than zero, searches are done in pages of this size using the paged
+	// results control, if the server supports it.
+	PageSize int
+
+	// Replace userPassword in Passwd and PasswdModify if the server doesn't support the
+	// password modify extended operation, instead of returning ErrUnsupported.
+	PasswdReplaceFallback bool
+
+	// Scheme to hash passwords with if PasswdReplaceFallback is set and Passwd has to set
+	// userPassword directly.
+	PasswordScheme string
+
 	// base DN to append
 	baseDn string
 
 	// Connection to use
 	conn *ldap.Connection
+
+	// Controls to send with every request
+	controls []ldap.Control
+
+	// If not nil, the response controls of every request are stored here
+	responseControls *responseControls
+
+	// Items to fill with the entry before and after modifications
+	preRead  *readEntry
+	postRead *readEntry
+
+	// Attributes to sort search results by
+	sortKeys []string
+
+	// Request operational attributes as well when reading
+	operational bool
+
+	// Write changes as LDIF to it instead of sending them
+	dryRun *ldif.Writer
+
+	// Called for every operation, see WithInterceptors
+	interceptors []Interceptor
+
+	// root DSE of the server, shared with derived Managers
+	rootDSE *rootDSECache
 }
 
 // New creates a new Manager.
@@ -54,7 +100,8 @@ type Manager struct {
 // The supplied Connection has to be connected and if necessary
 // bound.
 func New(c *ldap.Connection, baseDn string) *Manager {
-	return &Manager{Debug: false, conn: c, baseDn: baseDn}
+	return &Manager{Debug: false, MaxReplaceValues: 100, PasswordScheme: SchemeSSHA512, conn: c, baseDn: baseDn,
+		rootDSE: new(rootDSECache)}
 }
 
 // Close closes a Manger and its connections, preventing further usage.
@@ -80,17 +127,29 @@ func (c *Manager) appendBaseDn(dn string) string {
 }
 
 // Removes the baseDn if it is not empty, otherwise the
-// dn is returned unmodified
+// dn is returned unmodified. The entry of the baseDn itself becomes "",
+// dns not below the baseDn are returned unmodified as well.
 func (c *Manager) removeBaseDn(dn string) string {
 	if c.baseDn == "" {
 		return dn
 	}
 
-	return dn[0 : len(dn)-len(c.baseDn)-1]
+	rdns := strings.Split(dn, ",")
+	n := len(strings.Split(c.baseDn, ","))
+	if len(rdns) < n || normalizeDn(strings.Join(rdns[len(rdns)-n:], ",")) != normalizeDn(c.baseDn) {
+		return dn
+	}
+
+	return strings.Join(rdns[:len(rdns)-n], ",")
 }
 
 // Create item in LDAP
 func (c *Manager) Create(item Item) error {
+	err := beforeCreate(item)
+	if err != nil {
+		return err
+	}
+
 	entry, err := item.MarshalLDAP()
 	if err != nil {
 		return err
@@ -98,36 +157,113 @@ func (c *Manager) Create(item Item) error {
 
 	addRequest := ldap.NewAddRequest(c.appendBaseDn(item.Dn()))
 	addRequest.Entry.Attributes = entry.Attributes
+	addRequest.Controls = c.requestControls()
 
-	if c.Debug {
-		log.Println("Add request:", addRequest)
+	inv := &Invocation{Operation: OperationCreate, Dn: addRequest.Entry.DN, Item: item, Request: addRequest}
+	err = c.intercept(inv, func(inv *Invocation) error {
+		addRequest := inv.Request.(*ldap.AddRequest)
+
+		if c.Debug {
+			log.Println("Add request:", addRequest)
+		}
+
+		return c.doAdd(addRequest)
+	})
+	if err != nil {
+		return err
+	}
+
+	// nothing was added in dry run mode
+	if c.dryRun != nil {
+		return nil
 	}
 
-	return c.conn.Add(addRequest)
+	return afterCreate(item)
 }
 
 // Read values for the attributes of item from LDAP
 func (c *Manager) Read(item Item) error {
-	searchRequest := ldap.NewSimpleSearchRequest(c.appendBaseDn(item.Dn()), ldap.ScopeBaseObject, "(objectClass=*)", nil)
-
-	if c.Debug {
-		log.Println("Search request:", searchRequest)
+	entry, err := c.readEntry(item)
+	if err != nil {
+		return err
 	}
 
-	results, err := c.conn.Search(searchRequest)
+	return unmarshal(item, entry)
+}
+
+// readEntry reads the entry of item from LDAP
+func (c *Manager) readEntry(item Item) (*ldap.Entry, error) {
+	dn := c.appendBaseDn(item.Dn())
+	searchRequest := ldap.NewSimpleSearchRequest(dn, ldap.ScopeBaseObject, "(objectClass=*)", c.attributes())
+	searchRequest.Controls = c.requestControls()
+
+	inv := &Invocation{Operation: OperationRead, Dn: dn, Item: item, Request: searchRequest}
+	err := c.intercept(inv, func(inv *Invocation) error {
+		searchRequest := inv.Request.(*ldap.SearchRequest)
+
+		if c.Debug {
+			log.Println("Search request:", searchRequest)
+		}
+
+		results, err := c.doSearch(searchRequest)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range results.Entries {
+			err = c.fetchRanges(v)
+			if err != nil {
+				return err
+			}
+
+			v.DN = c.removeBaseDn(v.DN)
+		}
+
+		inv.Entries = results.Entries
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(results.Entries) == 0 {
-		return errors.New("No search results.")
-	} else if len(results.Entries) > 1 {
-		return errors.New("More than one search result.")
+	if len(inv.Entries) == 0 {
+		return nil, errors.New("No search results.")
+	} else if len(inv.Entries) > 1 {
+		return nil, errors.New("More than one search result.")
 	}
 
-	results.Entries[0].DN = c.removeBaseDn(results.Entries[0].DN)
+	return inv.Entries[0], nil
+}
+
+// Compare asks the server if the entry of item has the attribute attr with the value value,
+// without reading the entry. This works even if ACLs allow compare but not read access.
+// If the entry or the attribute don't exist, ErrNoSuchObject or ErrNoSuchAttribute is returned.
+func (c *Manager) Compare(item Item, attr, value string) (bool, error) {
+	compareRequest := ldap.NewCompareRequest(c.appendBaseDn(item.Dn()), attr, value)
+	compareRequest.Controls = c.requestControls()
+
+	inv := &Invocation{Operation: OperationCompare, Dn: compareRequest.DN, Item: item, Request: compareRequest}
+	err := c.intercept(inv, func(inv *Invocation) error {
+		compareRequest := inv.Request.(*ldap.CompareRequest)
+
+		if c.Debug {
+			log.Println("Compare request:", compareRequest)
+		}
+
+		var err error
+		inv.Compared, err = c.doCompare(compareRequest)
+		return err
+	})
+	if code, ok := resultCode(err); ok {
+		switch code {
+		case resultNoSuchObject:
+			return false, ErrNoSuchObject
+		case resultNoSuchAttribute:
+			return false, ErrNoSuchAttribute
+		}
+	}
 
-	return item.UnmarshalLDAP(results.Entries[0])
+	return inv.Compared, err
 }
 
 // ReadAll searches for all objects which are of the same type as item and match the criteria.
@@ -135,29 +271,15 @@ func (c *Manager) Read(item Item) error {
 // is a fmt format string used as filter with args being values for the format string. The arguments are
 // automatically escaped and must fmt.Print to a sane (at least for your LDAP data) value.
 func (c *Manager) ReadAll(item Item, dn string, scope Scope, filter string, args ...interface{}) ([]Item, error) {
-	filteredArgs := make([]interface{}, len(args))
-	for i, v := range args {
-		filteredArgs[i] = ldap.FilterReplace(fmt.Sprint(v))
-	}
-
-	realFilter := fmt.Sprintf(filter, filteredArgs...)
-
-	searchRequest := ldap.NewSimpleSearchRequest(c.appendBaseDn(dn), ldap.Scope(scope), realFilter, nil)
-
-	if c.Debug {
-		log.Println("Search Request:", searchRequest)
-	}
-
-	results, err := c.conn.Search(searchRequest)
+	entries, err := c.search(item, dn, scope, filter, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	items := make([]Item, len(results.Entries))
-	for i, v := range results.Entries {
-		v.DN = c.removeBaseDn(v.DN)
+	items := make([]Item, len(entries))
+	for i, v := range entries {
 		items[i] = item.Copy()
-		items[i].UnmarshalLDAP(v)
+		err = unmarshal(items[i], v)
 		if err != nil {
 			return nil, err
 		}
@@ -166,6 +288,52 @@ func (c *Manager) ReadAll(item Item, dn string, scope Scope, filter string, args
 	return items, nil
 }
 
+// search performs the search described by the ReadAll arguments and returns the found
+// entries with the baseDn removed from their DNs. item may be nil.
+func (c *Manager) search(item Item, dn string, scope Scope, filter string, args ...interface{}) ([]*ldap.Entry, error) {
+	base := c.appendBaseDn(dn)
+	searchRequest := ldap.NewSimpleSearchRequest(base, ldap.Scope(scope), formatFilter(filter, args...), c.attributes())
+	searchRequest.Controls = c.requestControls()
+
+	inv := &Invocation{Operation: OperationReadAll, Dn: base, Item: item, Request: searchRequest}
+	err := c.intercept(inv, func(inv *Invocation) error {
+		searchRequest := inv.Request.(*ldap.SearchRequest)
+
+		if c.Debug {
+			log.Println("Search Request:", searchRequest)
+		}
+
+		entries, err := c.searchEntries(searchRequest)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range entries {
+			err = c.fetchRanges(v)
+			if err != nil {
+				return err
+			}
+
+			v.DN = c.removeBaseDn(v.DN)
+		}
+
+		inv.Entries = entries
+		return nil
+	})
+
+	return inv.Entries, err
+}
+
+// formatFilter formats filter with the escaped args
+func formatFilter(filter string, args ...interface{}) string {
+	filteredArgs := make([]interface{}, len(args))
+	for i, v := range args {
+		filteredArgs[i] = ldap.FilterReplace(fmt.Sprint(v))
+	}
+
+	return fmt.Sprintf(filter, filteredArgs...)
+}
+
 // parentDn returns the dn of the parent item. it does so by removing the first
 // of comma-seperated fields of dn. The resulting dn may be the empty string.
 func parentDn(dn string) string {
@@ -203,6 +371,7 @@ func equalStringSlice(a, b []string) bool {
 // Build list of ldap modification operations
 func (c *Manager) newModifyRequest(oldItem Item, newItem Item) (*ldap.ModifyRequest, error) {
 	modifyRequest := ldap.NewModifyRequest(c.appendBaseDn(oldItem.Dn()))
+	modifyRequest.Controls = c.requestControls()
 
 	oldEntry, err := oldItem.MarshalLDAP()
 	if err != nil {
@@ -214,21 +383,39 @@ func (c *Manager) newModifyRequest(oldItem Item, newItem Item) (*ldap.ModifyRequ
 		return nil, err
 	}
 
-	// Remove all entries that no more exist
-	for _, v := range oldEntry.Attributes {
-		oldValues := oldEntry.GetAttributeValues(v.Name)
-		newValues := newEntry.GetAttributeValues(v.Name)
+	oldAttributes := newAttributeSet(oldEntry)
+	newAttributes := newAttributeSet(newEntry)
 
-		// if an attribute existed in oldEntry but not in newEntry, delete it
-		if len(newValues) == 0 {
-			modifyRequest.AddMod(ldap.NewMod(ldap.ModDelete, v.Name, oldValues))
+	// Remove all attributes that no more exist. Attributes are compared by their
+	// attribute description, so "description;lang-de" is kept apart from "description".
+	for _, k := range oldAttributes.keys {
+		if _, ok := newAttributes.attributes[k]; !ok {
+			v := oldAttributes.attributes[k]
+			modifyRequest.AddMod(ldap.NewMod(ldap.ModDelete, v.Name, v.Values))
 		}
 	}
 
-	// Add or Modify the other entries.
-	for _, v := range newEntry.Attributes {
-		newValues := newEntry.GetAttributeValues(v.Name)
-		modifyRequest.AddMod(ldap.NewMod(ldap.ModReplace, v.Name, newValues))
+	// Add or Modify the other attributes, skipping those with unchanged values.
+	for _, k := range newAttributes.keys {
+		v := newAttributes.attributes[k]
+		old, ok := oldAttributes.attributes[k]
+		if ok && equalValues(old.Values, v.Values) {
+			continue
+		}
+
+		// modify huge attributes value by value
+		if ok && (len(old.Values) > c.MaxReplaceValues || len(v.Values) > c.MaxReplaceValues) {
+			deleted, added := diffValues(old.Values, v.Values)
+			if len(deleted) > 0 {
+				modifyRequest.AddMod(ldap.NewMod(ldap.ModDelete, v.Name, deleted))
+			}
+			if len(added) > 0 {
+				modifyRequest.AddMod(ldap.NewMod(ldap.ModAdd, v.Name, added))
+			}
+			continue
+		}
+
+		modifyRequest.AddMod(ldap.NewMod(ldap.ModReplace, v.Name, v.Values))
 	}
 
 	return modifyRequest, nil
@@ -245,6 +432,11 @@ func (c *Manager) Update(newItem Item) error {
 		return err
 	}
 
+	err = beforeUpdate(newItem, oldItem)
+	if err != nil {
+		return err
+	}
+
 	if c.Debug {
 		log.Printf("Old item: %+v\n", oldItem)
 		log.Printf("New item: %+v\n", newItem)
@@ -255,40 +447,69 @@ func (c *Manager) Update(newItem Item) error {
 		return err
 	}
 
-	if c.Debug {
-		log.Println("Modify request:", modifyRequest)
+	// nothing changed
+	if len(modifyRequest.Mods) == 0 {
+		return nil
 	}
 
-	return c.conn.Modify(modifyRequest)
+	inv := &Invocation{Operation: OperationUpdate, Dn: modifyRequest.DN, Item: newItem, Old: oldItem, Request: modifyRequest}
+	return c.intercept(inv, func(inv *Invocation) error {
+		modifyRequest := inv.Request.(*ldap.ModifyRequest)
+
+		if c.Debug {
+			log.Println("Modify request:", modifyRequest)
+		}
+
+		return c.doModify(modifyRequest)
+	})
 }
 
 // Delete an item
 func (c *Manager) Delete(item Item) error {
+	err := beforeDelete(item)
+	if err != nil {
+		return err
+	}
+
 	deleteRequest := ldap.NewDeleteRequest(c.appendBaseDn(item.Dn()))
+	deleteRequest.Controls = c.requestControls()
 
-	if c.Debug {
-		log.Println("Delete Request:", deleteRequest)
-	}
+	inv := &Invocation{Operation: OperationDelete, Dn: deleteRequest.DN, Item: item, Request: deleteRequest}
+	return c.intercept(inv, func(inv *Invocation) error {
+		deleteRequest := inv.Request.(*ldap.DeleteRequest)
+
+		if c.Debug {
+			log.Println("Delete Request:", deleteRequest)
+		}
 
-	return c.conn.Delete(deleteRequest)
+		return c.doDelete(deleteRequest)
+	})
 }
 
 // Helper method to recursively delete a subtree
 func (c *Manager) deleteRecursive(dn string) error {
 	// first recursively delete all subentrys
 	searchRequest := ldap.NewSimpleSearchRequest(dn, ldap.ScopeSingleLevel, "(objectClass=*)", nil)
+	searchRequest.Controls = c.requestControls()
 
 	if c.Debug {
 		log.Println("Search Request:", searchRequest)
 	}
 
-	results, err := c.conn.Search(searchRequest)
+	entries, err := c.searchEntries(searchRequest)
 	if err != nil {
 		return err
 	}
 
-	for _, v := range results.Entries {
-		err = c.deleteRecursive(v.DN)
+	// only the root of the subtree is pre-read, the entries below would overwrite it
+	below := c
+	if c.preRead != nil {
+		below = c.derive()
+		below.preRead = nil
+	}
+
+	for _, v := range entries {
+		err = below.deleteRecursive(v.DN)
 		if err != nil {
 			return err
 		}
@@ -296,27 +517,39 @@ func (c *Manager) deleteRecursive(dn string) error {
 
 	// delete the root of the current tree
 	deleteRequest := ldap.NewDeleteRequest(dn)
-	return c.conn.Delete(deleteRequest)
+	deleteRequest.Controls = c.requestControls()
+	return c.doDelete(deleteRequest)
 }
 
-// DeleteSubtree recursively deletes a subtree without using special controls.
+// DeleteSubtree deletes a subtree. If the server supports the tree delete control,
+// the subtree is deleted in one operation, otherwise it is deleted recursively.
 func (c *Manager) DeleteSubtree(item Item) error {
-	return c.deleteRecursive(c.appendBaseDn(item.Dn()))
-}
-
-// Passwd changes the password of a dn.
-func (c *Manager) Passwd(item Item, passwd string) error {
-	var dn string
-	if item == nil {
-		dn = ""
-	} else {
-		dn = c.appendBaseDn(item.Dn())
+	err := beforeDelete(item)
+	if err != nil {
+		return err
 	}
-	passwdRequest := ldap.PasswordModifyRequest{dn, "", passwd}
 
-	if c.Debug {
-		log.Println("Password Request:", passwdRequest)
-	}
+	dn := c.appendBaseDn(item.Dn())
+
+	return c.intercept(&Invocation{Operation: OperationDeleteSubtree, Dn: dn, Item: item}, func(*Invocation) error {
+		if c.supportsControl(oidTreeDelete) {
+			deleteRequest := ldap.NewDeleteRequest(dn)
+			deleteRequest.Controls = c.requestControls(ldap.NewControlString(oidTreeDelete, false, ""))
+
+			err := c.doDelete(deleteRequest)
+			if code, ok := resultCode(err); !ok || (code != resultNotAllowedOnNonLeaf && code != resultUnavailableCriticalExtension) {
+				return err
+			}
+		}
+
+		return c.deleteRecursive(dn)
+	})
+}
 
-	return c.conn.Passwd(&passwdRequest)
+// Passwd changes the password of a dn. If item is nil, the password of the
+// bound user is changed. See PasswdModify for verifying the old password and
+// server-generated passwords.
+func (c *Manager) Passwd(item Item, passwd string) error {
+	_, err := c.PasswdModify(item, "", passwd)
+	return err
 }
@@ -1,11 +1,16 @@
 package crud
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"github.com/bytemine/ldap-crud/ldif"
 	"github.com/bytemine/ldap-crud/slapd"
 	"github.com/rbns/ldap"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 var foobarPerson = Person{sn: []string{"Foobar"}}
@@ -14,6 +19,9 @@ var fritzBarbazPerson = Person{sn: []string{"Bazbar"}, cn: []string{"Fritz"}}
 var fritzQuxPerson = Person{sn: []string{"Qux"}, cn: []string{"Fritz"}, dn: "sn=Qux,sn=Foobar"}
 var gonzoPerson = Person{sn: []string{"Foobar"}, cn: []string{"Gonzo", "von"}}
 
+// userPassword of all test persons, "foobar" hashed client-side
+var foobarPassword, _ = HashPassword(SchemeSSHA, "foobar")
+
 // Standard LDAP person with its must attributes
 type Person struct {
 	dn string
@@ -58,7 +66,7 @@ func (p *Person) MarshalLDAP() (*ldap.Entry, error) {
 
 	entry.AddAttributeValues("sn", p.sn)
 	entry.AddAttributeValues("cn", p.cn)
-	entry.AddAttributeValue("userPassword", "foobar")
+	entry.AddAttributeValue("userPassword", foobarPassword)
 
 	return entry, nil
 }
@@ -92,6 +100,20 @@ func TestRemoveBaseDn(t *testing.T) {
 	if c.removeBaseDn("cn=foo,dc=example,dc=com") != "cn=foo" {
 		t.Fail()
 	}
+
+	if c.removeBaseDn("cn=foo, DC=Example,dc=com") != "cn=foo" {
+		t.Error("base DN differing in case and spacing wasn't removed")
+	}
+
+	if c.removeBaseDn("dc=example,dc=com") != "" {
+		t.Error("base DN itself wasn't removed")
+	}
+
+	for _, v := range []string{"dc=com", "cn=foo,dc=example,dc=org", ""} {
+		if c.removeBaseDn(v) != v {
+			t.Error("DN outside of the base DN was modified:", v)
+		}
+	}
 }
 
 func TestParentDn(t *testing.T) {
@@ -244,6 +266,82 @@ func TestUpdate(t *testing.T) {
 	testUpdate(t)
 }
 
+// dial connects to the slapd configured by config
+func dial(t *testing.T, config *slapd.Config) *ldap.Connection {
+	lc := ldap.NewConnection(config.Address())
+	err := lc.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return lc
+}
+
+// dialAdmin returns a Manager bound as the rootdn of the slapd configured by config
+func dialAdmin(t *testing.T, config *slapd.Config) *Manager {
+	lc := dial(t, config)
+	err := lc.Bind(config.Rootdn.Dn, config.Rootdn.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(lc, config.Suffix.Dn)
+}
+
+// startSlapd starts and initializes a slapd configured by config and returns a Manager
+// bound as its rootdn, and a function stopping the slapd.
+func startSlapd(t *testing.T, config *slapd.Config) (*Manager, func()) {
+	s := slapd.New(config)
+
+	// t.Fatal doesn't return, so stop slapd in a deferred function if starting failed
+	started := false
+	defer func() {
+		if !started {
+			s.Stop()
+		}
+	}()
+
+	err := s.StartAndInitialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := dialAdmin(t, config)
+	started = true
+
+	return c, func() { s.Stop() }
+}
+
+func TestCompare(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ok, err := c.Compare(&fritzFoobarPerson, "cn", "Fritz")
+	if err != nil || !ok {
+		t.Error("compare of existing value failed:", ok, err)
+	}
+
+	ok, err = c.Compare(&fritzFoobarPerson, "cn", "Gonzo")
+	if err != nil || ok {
+		t.Error("compare of non-existing value succeeded:", ok, err)
+	}
+
+	_, err = c.Compare(&fritzFoobarPerson, "description", "Fritz")
+	if err != ErrNoSuchAttribute {
+		t.Error("Expected ErrNoSuchAttribute, got", err)
+	}
+
+	_, err = c.Compare(&fritzBarbazPerson, "cn", "Fritz")
+	if err != ErrNoSuchObject {
+		t.Error("Expected ErrNoSuchObject, got", err)
+	}
+}
+
 func testReadAll(t *testing.T) {
 	lc := ldap.NewConnection("localhost:9999")
 	err := lc.Connect()
@@ -599,3 +697,624 @@ func TestPasswd(t *testing.T) {
 	}
 
 }
+
+func TestAuthenticate(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	c.Pool = NewPool(func() (*ldap.Connection, error) {
+		conn := ldap.NewConnection(slapd.DefaultConfig.Address())
+		return conn, conn.Connect()
+	}, 1)
+	defer c.Pool.Close()
+
+	// create test person with password "foobar"
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.Authenticate(&fritzFoobarPerson, "foobar")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.Authenticate(&fritzFoobarPerson, "foobaz")
+	if err != ErrInvalidCredentials {
+		t.Error("Expected ErrInvalidCredentials, got", err)
+	}
+
+	err = c.Authenticate(&fritzFoobarPerson, "")
+	if err != ErrEmptyPassword {
+		t.Error("Expected ErrEmptyPassword, got", err)
+	}
+
+	// the connection of the manager must still be bound as admin
+	err = c.Update(&gonzoPerson)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	_, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	pool := NewPool(func() (*ldap.Connection, error) {
+		return dial(t, &slapd.DefaultConfig), nil
+	}, 1)
+
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pool.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// connections in use while the pool is closed are closed when put back
+	pool.Put(conn)
+
+	_, err = pool.Get()
+	if err == nil {
+		t.Error("expected an error getting a connection of a closed pool")
+	}
+
+	err = pool.Close()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasswdModify(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	// create test person with password "foobar"
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// let the server generate a password
+	genPasswd, err := c.PasswdModify(&fritzFoobarPerson, "", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if genPasswd == "" {
+		t.Error("server didn't generate a password")
+	}
+
+	c.Close()
+
+	lc := dial(t, &slapd.DefaultConfig)
+
+	// login as the test person with the generated password
+	err = lc.Bind(fritzFoobarPerson.Dn()+","+slapd.DefaultConfig.Suffix.Dn, genPasswd)
+	if err != nil {
+		t.Error(err)
+	}
+
+	c = New(lc, "dc=example,dc=com")
+
+	// changing the own password with a wrong old password must fail
+	_, err = c.PasswdModify(nil, "wrong", "foobaz")
+	if err == nil {
+		t.Error("password was changed with wrong old password")
+	}
+
+	_, err = c.PasswdModify(nil, genPasswd, "foobaz")
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Close()
+}
+
+func TestPasswdModifyRootDSEDenied(t *testing.T) {
+	// users may not read the root DSE
+	config := slapd.DefaultConfig
+	config.ConfigTemplate = "access to dn.base=\"\" by * none\n" + slapd.DefaultConfigTemplate
+
+	c, stop := startSlapd(t, &config)
+	defer stop()
+
+	// create test person with password "foobar"
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	lc := dial(t, &config)
+	err = lc.Bind(fritzFoobarPerson.Dn()+","+config.Suffix.Dn, "foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = New(lc, "dc=example,dc=com")
+	defer c.Close()
+
+	_, err = c.RootDSE()
+	if err == nil {
+		t.Error("expected reading the root DSE to fail")
+	}
+
+	// the extended operation is assumed to be supported
+	_, err = c.PasswdModify(nil, "foobar", "foobaz")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	authzId, err := c.WhoAmI()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if authzId != "dn:"+slapd.DefaultConfig.Rootdn.Dn {
+		t.Error("unexpected authorization identity:", authzId)
+	}
+
+	err = c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// the rootdn may proxy every user
+	authzId, err = c.As(fritzFoobarPerson.Dn()).WhoAmI()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if authzId != "dn:"+fritzFoobarPerson.Dn()+","+slapd.DefaultConfig.Suffix.Dn {
+		t.Error("unexpected proxied authorization identity:", authzId)
+	}
+}
+
+func TestPostRead(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	// read the operational attributes of the created entry
+	created := NewDynamic("")
+	err := c.WithPostRead(created, "entryUUID", "createTimestamp").Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if created.GetValue("entryUUID") == "" || created.GetValue("createTimestamp") == "" {
+		t.Error("post-read didn't return operational attributes:", created)
+	}
+
+	// read the entry before and after an update
+	before := Person{}
+	after := Person{}
+	err = c.WithPreRead(&before).WithPostRead(&after).Update(&gonzoPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !equalStringSlice(before.cn, fritzFoobarPerson.cn) || !equalStringSlice(after.cn, gonzoPerson.cn) {
+		t.Error("unexpected entries. Before:", before, "After:", after)
+	}
+}
+
+func TestRootDSE(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	rootDSE, err := c.RootDSE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !containsString(rootDSE.NamingContexts, slapd.DefaultConfig.Suffix.Dn) {
+		t.Error("unexpected naming contexts:", rootDSE.NamingContexts)
+	}
+
+	if !rootDSE.SupportsExtension(oidPasswdModify) || !rootDSE.SupportsControl(oidPagedResults) {
+		t.Error("expected password modify and paged results to be supported")
+	}
+}
+
+func TestPagedSortedSearch(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.Create(&fritzBarbazPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// one entry per page, sorted by the server or locally
+	c.PageSize = 1
+	entries, err := c.WithSort("-sn").ReadAllSiblings(&foobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatal("Expected exactly two results, got", len(entries))
+	}
+
+	if entries[0].(*Person).sn[0] != "Foobar" || entries[1].(*Person).sn[0] != "Bazbar" {
+		t.Error("unexpected order:", entries[0].Dn(), entries[1].Dn())
+	}
+}
+
+// syncprovConfig returns the default config with the syncprov overlay
+func syncprovConfig() slapd.Config {
+	config := slapd.DefaultConfig
+	config.Modules = []string{"syncprov"}
+	config.Overlays = []string{"syncprov"}
+
+	// the directory of the slapd modules differs between distributions
+	if path := os.Getenv("SLAPD_MODULEPATH"); path != "" {
+		config.ModulePath = path
+	}
+
+	return config
+}
+
+func TestWatch(t *testing.T) {
+	config := syncprovConfig()
+	c, stop := startSlapd(t, &config)
+	defer stop()
+
+	// the watch needs a connection of its own
+	w := dialAdmin(t, &config)
+
+	events := make(chan Event, 10)
+	done := make(chan error)
+	go func() {
+		done <- w.Watch(&Person{}, nil, func(e Event) error {
+			events <- e
+			if e.Type == EventDelete {
+				return ErrStopWatch
+			}
+
+			return nil
+		}, "", ScopeWholeSubtree, "(objectClass=%v)", "person")
+	}()
+
+	next := func(expected EventType) Event {
+		select {
+		case e := <-events:
+			if e.Type != expected {
+				t.Errorf("expected %v event, got %v", expected, e.Type)
+			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for", expected, "event")
+		}
+
+		return Event{}
+	}
+
+	e := next(EventRefreshDone)
+	if e.Cookie == "" {
+		t.Error("expected a sync cookie")
+	}
+
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	e = next(EventAdd)
+	if e.Dn != fritzFoobarPerson.Dn() || e.EntryUUID == "" {
+		t.Errorf("unexpected add event: %+v", e)
+	}
+
+	if person, ok := e.Item.(*Person); !ok || !equalStringSlice(person.cn, fritzFoobarPerson.cn) {
+		t.Errorf("unexpected item: %+v", e.Item)
+	}
+
+	err = c.Delete(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	next(EventDelete)
+
+	err = <-done
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplicaFilter(t *testing.T) {
+	config := syncprovConfig()
+	c, stop := startSlapd(t, &config)
+	defer stop()
+
+	ou := NewDynamic("ou=percent")
+	ou.Set("objectClass", "organizationalUnit")
+	ou.Set("ou", "percent")
+	ou.Set("description", "100%")
+
+	err := c.Create(ou)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the filter of the Replica isn't formatted
+	r := NewReplica(dialAdmin(t, &config), "", ScopeWholeSubtree, "(description=100%)")
+	done := make(chan error)
+	go func() {
+		done <- r.Run()
+	}()
+
+	select {
+	case <-r.Ready():
+	case err := <-done:
+		t.Fatal("replica stopped:", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the replica")
+	}
+
+	items, err := r.ReadAll(NewDynamic(""), "", ScopeWholeSubtree, "(objectClass=*)")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 1 || items[0].Dn() != "ou=percent" {
+		t.Error("unexpected results:", items)
+	}
+
+	r.Close()
+	err = <-done
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	m, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	c := NewCache(m)
+
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	person := foobarPerson
+	err = c.Read(&person)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// writes of other connections aren't seen
+	other := dialAdmin(t, &slapd.DefaultConfig)
+	defer other.Close()
+
+	gonzo := gonzoPerson
+	err = other.Update(&gonzo)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.Read(&person)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !equalStringSlice(person.cn, fritzFoobarPerson.cn) {
+		t.Error("expected cached values, got", person.cn)
+	}
+
+	fritz := fritzFoobarPerson
+	err = other.Update(&fritz)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// writes of the Manager invalidate the cache, also without going through it
+	err = m.Update(&gonzo)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.Read(&person)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !equalStringSlice(person.cn, gonzoPerson.cn) {
+		t.Error("expected updated values, got", person.cn)
+	}
+
+	persons, err := c.ReadAllSiblings(&foobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(persons) != 1 {
+		t.Error("Expected exactly one result, got", len(persons))
+	}
+
+	err = c.Delete(&foobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	persons, err = c.ReadAllSiblings(&foobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(persons) != 0 {
+		t.Error("Expected no results after delete, got", len(persons))
+	}
+}
+
+func TestApplyLDIF(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	input := `dn: sn=Foobar,dc=example,dc=com
+objectClass: person
+sn: Foobar
+cn: Fritz
+
+dn: sn=Missing,dc=example,dc=com
+changetype: delete
+
+dn: sn=Foobar,dc=example,dc=com
+changetype: modify
+replace: cn
+cn: Gonzo
+cn: von
+-
+`
+
+	results, err := c.ApplyLDIF(ldif.NewReader(strings.NewReader(input)), true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(results) != 3 || results[0].Err != nil || results[1].Err == nil || results[2].Err != nil {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	person := foobarPerson
+	err = c.Read(&person)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !equalStringSlice(person.cn, gonzoPerson.cn) {
+		t.Error("unexpected cn:", person.cn)
+	}
+}
+
+func TestDryRunUpdate(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var b bytes.Buffer
+	gonzo := gonzoPerson
+	err = c.DryRun(ldif.NewWriter(&b)).Update(&gonzo)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !strings.Contains(b.String(), "changetype: modify\n") || !strings.Contains(b.String(), "cn: Gonzo\n") {
+		t.Errorf("unexpected LDIF:\n%v", b.String())
+	}
+
+	// nothing was written to the server
+	person := foobarPerson
+	err = c.Read(&person)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !equalStringSlice(person.cn, fritzFoobarPerson.cn) {
+		t.Error("expected unchanged values, got", person.cn)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	m, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	var b bytes.Buffer
+	c := m.WithInterceptors(NewAuditor(NewJSONAuditSink(&b)).Interceptor())
+
+	err := c.Create(&fritzFoobarPerson)
+	if err != nil {
+		t.Error(err)
+	}
+
+	gonzo := gonzoPerson
+	err = c.Update(&gonzo)
+	if err != nil {
+		t.Error(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", lines)
+	}
+
+	if !strings.Contains(lines[1], `"Actor":"dn:`+slapd.DefaultConfig.Rootdn.Dn+`"`) || !strings.Contains(lines[1], `"Operation":"update"`) {
+		t.Error("unexpected record:", lines[1])
+	}
+
+	if strings.Contains(b.String(), foobarPassword) {
+		t.Error("expected password to be redacted:", b.String())
+	}
+}
+
+func TestBulkCreate(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	pool := NewPool(func() (*ldap.Connection, error) {
+		conn := ldap.NewConnection(slapd.DefaultConfig.Address())
+		return conn, conn.Connect()
+	}, 4)
+	defer pool.Close()
+
+	options := &BulkOptions{Workers: 4, Pool: pool, Bind: func(conn *ldap.Connection) error {
+		return conn.Bind(slapd.DefaultConfig.Rootdn.Dn, slapd.DefaultConfig.Rootdn.Password)
+	}}
+
+	items := make([]Item, 20)
+	for i := range items {
+		items[i] = NewPerson([]string{fmt.Sprintf("Bulk%d", i)}, []string{"Fritz"})
+	}
+
+	// the duplicate fails, the other items are created nonetheless
+	items = append(items, NewPerson([]string{"Bulk0"}, []string{"Fritz"}))
+
+	results := c.BulkCreate(items, options)
+	for i, v := range results {
+		if (i == 20) != (v.Err != nil) {
+			t.Errorf("unexpected error for item %d: %v", i, v.Err)
+		}
+	}
+
+	// the connections bound as the rootdn aren't put back
+	if len(pool.idle) != 0 {
+		t.Error("expected no idle connections, got", len(pool.idle))
+	}
+
+	persons, err := c.ReadAll(&foobarPerson, "", ScopeSingleLevel, "(sn=Bulk*)")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(persons) != 20 {
+		t.Error("expected 20 persons, got", len(persons))
+	}
+
+	results = c.BulkDelete(items[:20], options)
+	for i, v := range results {
+		if v.Err != nil {
+			t.Errorf("unexpected error for item %d: %v", i, v.Err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package crud
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/rbns/ldap"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInsecureBind is returned by Dial if a simple bind would be sent over an
+// unencrypted connection without AllowInsecureBind being set.
+var ErrInsecureBind = errors.New("Refusing simple bind over unencrypted connection.")
+
+// DialConfig describes how to connect and bind to an LDAP server.
+type DialConfig struct {
+	// URL of the server, "ldap://host:port", "ldaps://host:port" or "ldapi://path" with
+	// the path of the unix socket being URL-encoded, e.g. "ldapi://%2Fvar%2Frun%2Fldapi".
+	// If the port is omitted, the default port of the scheme is used.
+	URL string
+
+	// Use StartTLS on ldap:// connections
+	StartTLS bool
+
+	// Certificate authorities to verify the server certificate with. If nil, the
+	// system pool is used.
+	RootCAs *x509.CertPool
+
+	// Client certificates to present to the server
+	Certificates []tls.Certificate
+
+	// Minimum TLS version. If zero, TLS 1.2 is used.
+	MinVersion uint16
+
+	// Name to verify the server certificate against. If empty, the host of URL is used.
+	ServerName string
+
+	// Don't verify the server certificate. Only use this for testing.
+	InsecureSkipVerify bool
+
+	// DN and password for a simple bind. If BindDn is empty, the connection is not bound.
+	BindDn   string
+	Password string
+
+	// Allow simple binds over unencrypted connections, sending the password in clear text.
+	// Connections over unix sockets count as encrypted.
+	AllowInsecureBind bool
+
+	// Bind with SASL EXTERNAL instead of a simple bind, authenticating with the credentials
+	// of the process on ldapi:// or the client certificate on TLS connections.
+	SASLExternal bool
+
+	// Authorization identity to request with SASL EXTERNAL, e.g. "dn:cn=admin,dc=example,dc=com".
+	// If empty, the identity derived from the credentials is used.
+	AuthzId string
+
+	// Timeout for establishing the connection. If zero, the default of the ldap package is used.
+	Timeout time.Duration
+}
+
+// address returns the scheme and the host:port of the URL, with the default port filled in.
+// For ldapi:// URLs, the path of the socket is returned instead of host:port.
+func (d DialConfig) address() (string, string, error) {
+	// url.Parse doesn't accept the escaped socket path as host
+	if strings.HasPrefix(d.URL, "ldapi://") {
+		path, err := url.PathUnescape(strings.TrimSuffix(d.URL[len("ldapi://"):], "/"))
+		if err != nil {
+			return "", "", err
+		}
+		return "ldapi", path, nil
+	}
+
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return "", "", err
+	}
+
+	var port string
+	switch u.Scheme {
+	case "ldap":
+		port = "389"
+	case "ldaps":
+		port = "636"
+	default:
+		return "", "", fmt.Errorf("Unsupported URL scheme: %v", u.Scheme)
+	}
+
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// tlsConfig returns the tls.Config described by the DialConfig for connecting to host.
+func (d DialConfig) tlsConfig(host string) *tls.Config {
+	config := &tls.Config{
+		RootCAs:            d.RootCAs,
+		Certificates:       d.Certificates,
+		MinVersion:         d.MinVersion,
+		ServerName:         d.ServerName,
+		InsecureSkipVerify: d.InsecureSkipVerify,
+	}
+
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	return config
+}
+
+// Dial connects to the server and, if BindDn or SASLExternal is set, binds. Simple binds over
+// unencrypted connections are refused with ErrInsecureBind, unless AllowInsecureBind
+// is set.
+//
+// The method value of a DialConfig can be used as DialFunc for a Pool.
+func (d DialConfig) Dial() (*ldap.Connection, error) {
+	scheme, addr, err := d.address()
+	if err != nil {
+		return nil, err
+	}
+
+	var host string
+	if scheme != "ldapi" {
+		host, _, err = net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var conn *ldap.Connection
+	var encrypted bool
+
+	switch {
+	case scheme == "ldapi":
+		conn = ldap.NewUnixConnection(addr)
+		encrypted = true
+	case scheme == "ldaps":
+		conn = ldap.NewSSLConnection(addr, d.tlsConfig(host))
+		encrypted = true
+	case d.StartTLS:
+		conn = ldap.NewTLSConnection(addr, d.tlsConfig(host))
+		encrypted = true
+	default:
+		conn = ldap.NewConnection(addr)
+	}
+
+	if d.BindDn != "" && !d.SASLExternal && !encrypted && !d.AllowInsecureBind {
+		return nil, ErrInsecureBind
+	}
+
+	if d.Timeout != 0 {
+		conn.NetworkConnectTimeout = d.Timeout
+	}
+
+	err = conn.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case d.SASLExternal:
+		err = conn.ExternalBind(d.AuthzId)
+	case d.BindDn != "":
+		err = conn.Bind(d.BindDn, d.Password)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
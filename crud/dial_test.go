@@ -0,0 +1,107 @@
+package crud
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/bytemine/ldap-crud/slapd"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDialConfigAddress(t *testing.T) {
+	tests := []struct {
+		url    string
+		scheme string
+		addr   string
+	}{
+		{"ldap://localhost", "ldap", "localhost:389"},
+		{"ldaps://localhost", "ldaps", "localhost:636"},
+		{"ldaps://127.0.0.1:9998", "ldaps", "127.0.0.1:9998"},
+		{"ldapi://%2Fvar%2Frun%2Fldapi", "ldapi", "/var/run/ldapi"},
+	}
+
+	for _, v := range tests {
+		scheme, addr, err := DialConfig{URL: v.url}.address()
+		if err != nil || scheme != v.scheme || addr != v.addr {
+			t.Error("unexpected address for", v.url, ":", scheme, addr, err)
+		}
+	}
+
+	_, _, err := DialConfig{URL: "http://localhost"}.address()
+	if err == nil {
+		t.Error("unsupported scheme was accepted")
+	}
+}
+
+func TestDialConfigTLSConfig(t *testing.T) {
+	config := DialConfig{}.tlsConfig("ldap.example.com")
+	if config.MinVersion != tls.VersionTLS12 || config.ServerName != "ldap.example.com" {
+		t.Error("unexpected tls config:", config)
+	}
+
+	config = DialConfig{MinVersion: tls.VersionTLS13, ServerName: "example.com"}.tlsConfig("127.0.0.1")
+	if config.MinVersion != tls.VersionTLS13 || config.ServerName != "example.com" {
+		t.Error("unexpected tls config:", config)
+	}
+}
+
+func TestDialInsecureBind(t *testing.T) {
+	_, err := DialConfig{URL: "ldap://127.0.0.1:1", BindDn: "cn=admin", Password: "secret"}.Dial()
+	if err != ErrInsecureBind {
+		t.Error("Expected ErrInsecureBind, got", err)
+	}
+}
+
+func TestDial(t *testing.T) {
+	config := slapd.DefaultConfig
+	config.TLSAddr = "127.0.0.1:9998"
+	config.Ldapi = true
+
+	_, stop := startSlapd(t, &config)
+	defer stop()
+
+	pem, err := ioutil.ReadFile(config.CertificateFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(pem) {
+		t.Fatal("no certificate in", config.CertificateFile())
+	}
+
+	tests := []DialConfig{
+		{URL: "ldaps://" + config.TLSAddr, RootCAs: rootCAs},
+		{URL: "ldap://" + config.Addr, StartTLS: true, RootCAs: rootCAs},
+		{URL: config.LdapiURL()},
+	}
+
+	for _, v := range tests {
+		v.BindDn, v.Password = config.Rootdn.Dn, config.Rootdn.Password
+
+		conn, err := v.Dial()
+		if err != nil {
+			t.Error("dialing", v.URL, "failed:", err)
+			continue
+		}
+
+		authzId, err := New(conn, config.Suffix.Dn).WhoAmI()
+		if err != nil || authzId != "dn:"+config.Rootdn.Dn {
+			t.Error("unexpected authorization identity on", v.URL, ":", authzId, err)
+		}
+
+		conn.Close()
+	}
+
+	// the process user is mapped to the rootdn by the slapd configuration
+	conn, err := DialConfig{URL: config.LdapiURL(), SASLExternal: true}.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	authzId, err := New(conn, config.Suffix.Dn).WhoAmI()
+	if err != nil || authzId != "dn:"+config.Rootdn.Dn {
+		t.Error("unexpected authorization identity with SASL EXTERNAL:", authzId, err)
+	}
+}
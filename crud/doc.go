@@ -9,7 +9,8 @@ to have more safety when handling LDAP. A Item implementation could for example
 typed fields for SINGLE-VALUE attributes and []string typed fields for multivalued attributes.
 
 An example for an implementation of the Item interface can be
-found in the tests.
+found in the tests. For entries without a specific type, e.g. in administrative
+tools, the map-backed Dynamic implements Item for arbitrary attributes.
 
 Note: To run the tests, you must have openldap installed.
 */
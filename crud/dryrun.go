@@ -0,0 +1,64 @@
+package crud
+
+import (
+	"errors"
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+)
+
+// ErrDryRun is returned for writes which can't be expressed as LDIF change records
+// in dry run mode, like password changes with the password modify extended operation.
+var ErrDryRun = errors.New("Operation not possible in dry run mode.")
+
+// DryRun returns a Manager which still reads from the server, but writes all changes as
+// LDIF change records to w instead of sending them. The records contain the requests
+// as they would be sent, e.g. the computed modifications of Update and the deletes of
+// DeleteSubtree, including the request controls. Nothing is written to the server.
+//
+// w is written to without synchronization, so the Manager mustn't be used concurrently.
+func (c *Manager) DryRun(w *ldif.Writer) *Manager {
+	m := c.derive()
+	m.dryRun = w
+	return m
+}
+
+// writeAdd writes an add request as change record
+func (c *Manager) writeAdd(addRequest *ldap.AddRequest) error {
+	return c.dryRun.WriteRecord(&ldif.Record{
+		Dn:         addRequest.Entry.DN,
+		ChangeType: ldif.ChangeAdd,
+		Entry:      addRequest.Entry,
+		Controls:   addRequest.Controls,
+	})
+}
+
+// writeModify writes a modify request as change record
+func (c *Manager) writeModify(modifyRequest *ldap.ModifyRequest) error {
+	return c.dryRun.WriteRecord(&ldif.Record{
+		Dn:         modifyRequest.DN,
+		ChangeType: ldif.ChangeModify,
+		Mods:       modifyRequest.Mods,
+		Controls:   modifyRequest.Controls,
+	})
+}
+
+// writeDelete writes a delete request as change record
+func (c *Manager) writeDelete(deleteRequest *ldap.DeleteRequest) error {
+	return c.dryRun.WriteRecord(&ldif.Record{
+		Dn:         deleteRequest.DN,
+		ChangeType: ldif.ChangeDelete,
+		Controls:   deleteRequest.Controls,
+	})
+}
+
+// writeModifyDN writes a modify DN request as change record
+func (c *Manager) writeModifyDN(modifyDNRequest *ldap.ModifyDNRequest) error {
+	return c.dryRun.WriteRecord(&ldif.Record{
+		Dn:           modifyDNRequest.DN,
+		ChangeType:   ldif.ChangeModRdn,
+		NewRdn:       modifyDNRequest.NewRDN,
+		DeleteOldRdn: modifyDNRequest.DeleteOldRDN,
+		NewSuperior:  modifyDNRequest.NewSuperior,
+		Controls:     modifyDNRequest.Controls,
+	})
+}
@@ -0,0 +1,44 @@
+package crud
+
+import (
+	"bytes"
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	var b bytes.Buffer
+	c := New(nil, "dc=example,dc=com").DryRun(ldif.NewWriter(&b))
+
+	err := c.Create(&OrganizationalUnit{dn: "ou=Groups", ou: []string{"Groups"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modifyRequest := ldap.NewModifyRequest("ou=Groups,dc=example,dc=com")
+	modifyRequest.AddMod(ldap.NewMod(ldap.ModReplace, "description", []string{"All groups"}))
+	err = c.doModify(modifyRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.WithControls(Control{OID: OIDNoOp, Criticality: true}).Delete(&OrganizationalUnit{dn: "ou=Groups"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.doExtended(&ldap.ExtendedRequest{Name: oidPasswdModify})
+	if err != ErrDryRun {
+		t.Error("expected ErrDryRun for password modify, got", err)
+	}
+
+	expected := "version: 1\n\n" +
+		"dn: ou=Groups,dc=example,dc=com\nchangetype: add\nobjectClass: organizationalUnit\nou: Groups\n\n" +
+		"dn: ou=Groups,dc=example,dc=com\nchangetype: modify\nreplace: description\ndescription: All groups\n-\n\n" +
+		"dn: ou=Groups,dc=example,dc=com\ncontrol: 1.3.6.1.4.1.4203.1.10.2 true\nchangetype: delete\n"
+
+	if b.String() != expected {
+		t.Errorf("unexpected LDIF:\n%v", b.String())
+	}
+}
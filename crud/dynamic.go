@@ -0,0 +1,238 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"strings"
+)
+
+// Dynamic is an Item holding arbitrary attributes, for handling entries without a
+// specific type. Attribute names are attribute descriptions and compared like in LDAP:
+// case-insensitively and with options kept apart from the base attribute, so
+// "description;lang-de" is a different attribute than "description".
+//
+// A Dynamic marshals to exactly the attributes it holds, so an Update with a Dynamic
+// read before removes all attributes which were removed from it in the meantime.
+type Dynamic struct {
+	dn string
+
+	// attributes keyed by their normalized attribute description
+	attributes map[string]*ldap.EntryAttribute
+
+	// normalized attribute descriptions in the order they were added
+	names []string
+}
+
+// NewDynamic creates an empty Dynamic with the given dn.
+func NewDynamic(dn string) *Dynamic {
+	return &Dynamic{dn: dn, attributes: make(map[string]*ldap.EntryAttribute)}
+}
+
+// Returns the DN of the Dynamic
+func (d *Dynamic) Dn() string {
+	return d.dn
+}
+
+// SetDn sets the DN of the Dynamic
+func (d *Dynamic) SetDn(dn string) {
+	d.dn = dn
+}
+
+// FilterObjectClass returns the structural object class of the Dynamic. It is taken from
+// the operational attribute structuralObjectClass if the Dynamic holds it, otherwise the
+// last objectClass value other than "top" is used, as object classes are usually listed
+// from the most general to the most specific one. If there is none, "top" is returned.
+func (d *Dynamic) FilterObjectClass() string {
+	if structural := d.GetValue("structuralObjectClass"); structural != "" {
+		return structural
+	}
+
+	objectClasses := d.Get("objectClass")
+	for i := len(objectClasses) - 1; i >= 0; i-- {
+		if !strings.EqualFold(objectClasses[i], "top") {
+			return objectClasses[i]
+		}
+	}
+
+	return "top"
+}
+
+// Returns a deep copy of the Dynamic
+func (d *Dynamic) Copy() Item {
+	c := NewDynamic(d.dn)
+	for _, v := range d.names {
+		attr := d.attributes[v]
+		c.Set(attr.Name, attr.Values...)
+	}
+
+	return c
+}
+
+// Names returns the names of all attributes held, in the order they were added.
+func (d *Dynamic) Names() []string {
+	names := make([]string, len(d.names))
+	for i, v := range d.names {
+		names[i] = d.attributes[v].Name
+	}
+
+	return names
+}
+
+// Has reports if the Dynamic holds the attribute name.
+func (d *Dynamic) Has(name string) bool {
+	_, ok := d.attributes[attributeKey(name)]
+	return ok
+}
+
+// Get returns the values of the attribute name. If the attribute isn't
+// set, an empty slice is returned.
+func (d *Dynamic) Get(name string) []string {
+	attr, ok := d.attributes[attributeKey(name)]
+	if !ok {
+		return []string{}
+	}
+
+	values := make([]string, len(attr.Values))
+	copy(values, attr.Values)
+	return values
+}
+
+// GetValue returns the first value of the attribute name, or the empty
+// string if the attribute isn't set.
+func (d *Dynamic) GetValue(name string) string {
+	attr, ok := d.attributes[attributeKey(name)]
+	if !ok || len(attr.Values) == 0 {
+		return ""
+	}
+
+	return attr.Values[0]
+}
+
+// Set replaces the values of the attribute name. Setting no values
+// removes the attribute.
+func (d *Dynamic) Set(name string, values ...string) {
+	if len(values) == 0 {
+		d.Remove(name)
+		return
+	}
+
+	key := attributeKey(name)
+	attr, ok := d.attributes[key]
+	if !ok {
+		if d.attributes == nil {
+			d.attributes = make(map[string]*ldap.EntryAttribute)
+		}
+
+		attr = &ldap.EntryAttribute{Name: name}
+		d.attributes[key] = attr
+		d.names = append(d.names, key)
+	}
+
+	attr.Values = make([]string, len(values))
+	copy(attr.Values, values)
+}
+
+// Add adds values to the attribute name. Values already present are not
+// added again.
+func (d *Dynamic) Add(name string, values ...string) {
+	attr, ok := d.attributes[attributeKey(name)]
+	if !ok {
+		d.Set(name, values...)
+		return
+	}
+
+	for _, v := range values {
+		if !containsString(attr.Values, v) {
+			attr.Values = append(attr.Values, v)
+		}
+	}
+}
+
+// Remove removes values from the attribute name. If no values are given or
+// no values are left, the whole attribute is removed.
+func (d *Dynamic) Remove(name string, values ...string) {
+	key := attributeKey(name)
+	attr, ok := d.attributes[key]
+	if !ok {
+		return
+	}
+
+	if len(values) > 0 {
+		remaining := make([]string, 0, len(attr.Values))
+		for _, v := range attr.Values {
+			if !containsString(values, v) {
+				remaining = append(remaining, v)
+			}
+		}
+		attr.Values = remaining
+	}
+
+	if len(values) > 0 && len(attr.Values) > 0 {
+		return
+	}
+
+	delete(d.attributes, key)
+	for i, v := range d.names {
+		if v == key {
+			d.names = append(d.names[:i], d.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// GetBinary returns the values of the attribute name as byte slices.
+func (d *Dynamic) GetBinary(name string) [][]byte {
+	values := d.Get(name)
+	binValues := make([][]byte, len(values))
+	for i, v := range values {
+		binValues[i] = []byte(v)
+	}
+
+	return binValues
+}
+
+// SetBinary replaces the values of the attribute name with binary values.
+// Setting no values removes the attribute.
+func (d *Dynamic) SetBinary(name string, values ...[]byte) {
+	strValues := make([]string, len(values))
+	for i, v := range values {
+		strValues[i] = string(v)
+	}
+
+	d.Set(name, strValues...)
+}
+
+// Marshals all attributes of the Dynamic to an *ldap.Entry
+func (d *Dynamic) MarshalLDAP() (*ldap.Entry, error) {
+	entry := ldap.NewEntry("")
+	for _, v := range d.names {
+		attr := d.attributes[v]
+		entry.AddAttributeValues(attr.Name, attr.Values)
+	}
+
+	return entry, nil
+}
+
+// Unmarshals all attributes of entry into the Dynamic, replacing the
+// attributes held before.
+func (d *Dynamic) UnmarshalLDAP(entry *ldap.Entry) error {
+	d.dn = entry.DN
+	d.attributes = make(map[string]*ldap.EntryAttribute)
+	d.names = nil
+
+	for _, v := range entry.Attributes {
+		d.Add(v.Name, v.Values...)
+	}
+
+	return nil
+}
+
+// Does the string slice contain s?
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
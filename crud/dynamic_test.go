@@ -0,0 +1,93 @@
+package crud
+
+import (
+	"testing"
+)
+
+func TestDynamic(t *testing.T) {
+	d := NewDynamic("cn=Fritz")
+	d.Set("objectClass", "person")
+	d.Set("cn", "Fritz")
+	d.Add("CN", "Fritzchen", "Fritz")
+	d.Set("sn", "Foobar")
+
+	if !equalStringSlice(d.Get("cn"), []string{"Fritz", "Fritzchen"}) {
+		t.Error("unexpected cn values:", d.Get("cn"))
+	}
+
+	if d.GetValue("SN") != "Foobar" {
+		t.Error("unexpected sn value:", d.GetValue("SN"))
+	}
+
+	if d.FilterObjectClass() != "person" {
+		t.Error("unexpected filter object class:", d.FilterObjectClass())
+	}
+
+	d.Set("objectClass", "top", "person", "organizationalPerson")
+	if d.FilterObjectClass() != "organizationalPerson" {
+		t.Error("unexpected filter object class:", d.FilterObjectClass())
+	}
+
+	d.Set("structuralObjectClass", "inetOrgPerson")
+	if d.FilterObjectClass() != "inetOrgPerson" {
+		t.Error("unexpected filter object class:", d.FilterObjectClass())
+	}
+	d.Remove("structuralObjectClass")
+
+	d.Remove("cn", "Fritz")
+	if !equalStringSlice(d.Get("cn"), []string{"Fritzchen"}) {
+		t.Error("unexpected cn values after remove:", d.Get("cn"))
+	}
+
+	d.Remove("sn")
+	if d.Has("sn") {
+		t.Error("sn wasn't removed")
+	}
+
+	if !equalStringSlice(d.Names(), []string{"objectClass", "cn"}) {
+		t.Error("unexpected attribute names:", d.Names())
+	}
+}
+
+func TestDynamicZeroValue(t *testing.T) {
+	var d Dynamic
+	d.Add("cn", "Fritz")
+	d.Set("sn", "Foobar")
+
+	if d.GetValue("cn") != "Fritz" || d.GetValue("sn") != "Foobar" {
+		t.Error("unexpected attributes:", d.Names())
+	}
+
+	if d.FilterObjectClass() != "top" {
+		t.Error("unexpected filter object class:", d.FilterObjectClass())
+	}
+}
+
+func TestDynamicMarshalRoundtrip(t *testing.T) {
+	d := NewDynamic("cn=Fritz")
+	d.Set("objectClass", "top", "person")
+	d.Set("cn", "Fritz")
+	d.Set("sn", "Foobar")
+
+	entry, err := d.MarshalLDAP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.DN = d.Dn()
+
+	u := NewDynamic("")
+	err = u.UnmarshalLDAP(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Dn() != d.Dn() || !equalStringSlice(u.Names(), d.Names()) {
+		t.Error("unmarshalled Dynamic differs. Expected:", d, "Got:", u)
+	}
+
+	c := u.Copy().(*Dynamic)
+	c.Set("cn", "Gonzo")
+	if u.GetValue("cn") != "Fritz" {
+		t.Error("modifying a copy changed the original")
+	}
+}
@@ -0,0 +1,40 @@
+package crud
+
+import (
+	"errors"
+	"github.com/rbns/ldap"
+)
+
+// LDAP result codes (RFC 4511 section 4.1.9) the Manager handles specially
+const (
+	resultProtocolError                = 2
+	resultUnavailableCriticalExtension = 12
+	resultNoSuchAttribute              = 16
+	resultConstraintViolation          = 19
+	resultNoSuchObject                 = 32
+	resultInvalidCredentials           = 49
+	resultInsufficientAccessRights     = 50
+	resultUnavailable                  = 52
+	resultUnwillingToPerform           = 53
+	resultNotAllowedOnNonLeaf          = 66
+)
+
+// ErrNoSuchObject is returned if the entry an operation refers to doesn't exist.
+var ErrNoSuchObject = errors.New("No such object.")
+
+// ErrNoSuchAttribute is returned if the attribute an operation refers to doesn't exist
+// in the entry.
+var ErrNoSuchAttribute = errors.New("No such attribute.")
+
+// ErrUnsupported is returned if an operation can't be done because the server lacks
+// support for it.
+var ErrUnsupported = errors.New("Operation not supported by the server.")
+
+// resultCode returns the LDAP result code of err, if err is an LDAP error.
+func resultCode(err error) (uint8, bool) {
+	if e, ok := err.(*ldap.Error); ok {
+		return e.ResultCode, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,347 @@
+package crud
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/rbns/ldap"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFilter is returned if a search filter can't be parsed.
+var ErrInvalidFilter = errors.New("Invalid search filter.")
+
+// filter is a parsed search filter (RFC 4515) which can be evaluated locally.
+// Values are compared case-insensitively, as most attributes use caseIgnoreMatch,
+// and ordered numerically if both values are integers.
+type filter interface {
+	match(e *ldap.Entry) bool
+}
+
+type filterAnd []filter
+
+func (f filterAnd) match(e *ldap.Entry) bool {
+	for _, v := range f {
+		if !v.match(e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type filterOr []filter
+
+func (f filterOr) match(e *ldap.Entry) bool {
+	for _, v := range f {
+		if v.match(e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type filterNot struct {
+	filter filter
+}
+
+func (f filterNot) match(e *ldap.Entry) bool {
+	return !f.filter.match(e)
+}
+
+type filterPresent struct {
+	attr AttributeDescription
+}
+
+func (f filterPresent) match(e *ldap.Entry) bool {
+	return len(filterValues(e, f.attr)) > 0
+}
+
+// filterEquality also handles approximate matches
+type filterEquality struct {
+	attr  AttributeDescription
+	value string
+}
+
+func (f filterEquality) match(e *ldap.Entry) bool {
+	for _, v := range filterValues(e, f.attr) {
+		if strings.EqualFold(v, f.value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type filterOrdering struct {
+	attr  AttributeDescription
+	value string
+
+	// true for greaterOrEqual, false for lessOrEqual
+	greater bool
+}
+
+func (f filterOrdering) match(e *ldap.Entry) bool {
+	for _, v := range filterValues(e, f.attr) {
+		c := compareValues(v, f.value)
+		if (f.greater && c >= 0) || (!f.greater && c <= 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type filterSubstrings struct {
+	attr    AttributeDescription
+	initial string
+	any     []string
+	final   string
+}
+
+func (f filterSubstrings) match(e *ldap.Entry) bool {
+	for _, v := range filterValues(e, f.attr) {
+		if f.matchValue(strings.ToLower(v)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f filterSubstrings) matchValue(v string) bool {
+	if !strings.HasPrefix(v, f.initial) {
+		return false
+	}
+	v = v[len(f.initial):]
+
+	for _, s := range f.any {
+		i := strings.Index(v, s)
+		if i < 0 {
+			return false
+		}
+		v = v[i+len(s):]
+	}
+
+	return strings.HasSuffix(v, f.final)
+}
+
+// filterValues returns the values of the attributes of e matching attr. Attributes
+// with additional options match as well, e.g. "cn" matches "cn;lang-de".
+func filterValues(e *ldap.Entry, attr AttributeDescription) []string {
+	var values []string
+	for _, v := range e.Attributes {
+		desc := ParseAttributeDescription(v.Name)
+		if !strings.EqualFold(desc.Type, attr.Type) {
+			continue
+		}
+
+		matches := true
+		for _, o := range attr.Options {
+			if !desc.HasOption(o) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			values = append(values, v.Values...)
+		}
+	}
+
+	return values
+}
+
+// compareValues compares two values numerically if both are integers, otherwise
+// case-insensitively
+func compareValues(a, b string) int {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+
+		return 0
+	}
+
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// parseFilter parses a search filter. Extensible matches aren't supported.
+func parseFilter(s string) (filter, error) {
+	p := &filterParser{s: strings.TrimSpace(s)}
+
+	f, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.s) {
+		return nil, ErrInvalidFilter
+	}
+
+	return f, nil
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+// parse parses a parenthesized filter at the current position
+func (p *filterParser) parse() (filter, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return nil, ErrInvalidFilter
+	}
+	p.pos++
+
+	if p.pos >= len(p.s) {
+		return nil, ErrInvalidFilter
+	}
+
+	var f filter
+	var err error
+	switch p.s[p.pos] {
+	case '&':
+		p.pos++
+		var list []filter
+		list, err = p.parseList()
+		f = filterAnd(list)
+	case '|':
+		p.pos++
+		var list []filter
+		list, err = p.parseList()
+		f = filterOr(list)
+	case '!':
+		p.pos++
+		var not filter
+		not, err = p.parse()
+		f = filterNot{not}
+	default:
+		f, err = p.parseItem()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+		return nil, ErrInvalidFilter
+	}
+	p.pos++
+
+	return f, nil
+}
+
+// parseList parses filters until the closing parenthesis
+func (p *filterParser) parseList() ([]filter, error) {
+	var list []filter
+	for p.pos < len(p.s) && p.s[p.pos] == '(' {
+		f, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, f)
+	}
+
+	return list, nil
+}
+
+// parseItem parses a simple, present or substring filter
+func (p *filterParser) parseItem() (filter, error) {
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return nil, ErrInvalidFilter
+	}
+
+	item := p.s[p.pos : p.pos+end]
+	p.pos += end
+
+	eq := strings.IndexByte(item, '=')
+	if eq < 1 {
+		return nil, ErrInvalidFilter
+	}
+
+	attr, op, value := item[:eq], byte('='), item[eq+1:]
+	switch attr[len(attr)-1] {
+	case '~', '<', '>', ':':
+		attr, op = attr[:len(attr)-1], attr[len(attr)-1]
+	}
+
+	if attr == "" {
+		return nil, ErrInvalidFilter
+	}
+	desc := ParseAttributeDescription(attr)
+
+	switch op {
+	case ':':
+		return nil, ErrUnsupported
+	case '<', '>':
+		v, err := unescapeFilterValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return filterOrdering{attr: desc, value: v, greater: op == '>'}, nil
+	}
+
+	if value == "*" {
+		return filterPresent{attr: desc}, nil
+	}
+
+	if op == '=' && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		for i, v := range parts {
+			u, err := unescapeFilterValue(v)
+			if err != nil {
+				return nil, err
+			}
+
+			parts[i] = strings.ToLower(u)
+		}
+
+		return filterSubstrings{attr: desc, initial: parts[0], any: parts[1 : len(parts)-1], final: parts[len(parts)-1]}, nil
+	}
+
+	v, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterEquality{attr: desc, value: v}, nil
+}
+
+// unescapeFilterValue replaces \XX escapes in a filter value
+func unescapeFilterValue(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+
+		if i+3 > len(s) {
+			return "", ErrInvalidFilter
+		}
+
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", ErrInvalidFilter
+		}
+
+		b = append(b, c...)
+		i += 2
+	}
+
+	return string(b), nil
+}
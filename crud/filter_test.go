@@ -0,0 +1,65 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	entry := ldap.NewEntry("cn=Fritz,dc=example,dc=com")
+	entry.AddAttributeValues("objectClass", []string{"top", "person"})
+	entry.AddAttributeValue("cn", "Fritz")
+	entry.AddAttributeValue("sn", "Foobar")
+	entry.AddAttributeValue("description;lang-de", "Ein (Test)")
+	entry.AddAttributeValue("uidNumber", "1000")
+
+	tests := []struct {
+		filter string
+		match  bool
+	}{
+		{"(objectClass=*)", true},
+		{"(objectclass=PERSON)", true},
+		{"(cn=fritz)", true},
+		{"(cn=gonzo)", false},
+		{"(&(cn=Fritz)(sn=Foobar))", true},
+		{"(&(cn=Fritz)(sn=Qux))", false},
+		{"(|(cn=Gonzo)(sn=Foobar))", true},
+		{"(!(cn=Fritz))", false},
+		{"(cn=F*z)", true},
+		{"(cn=*ri*)", true},
+		{"(cn=*x*)", false},
+		{"(sn~=foobar)", true},
+		{"(uidNumber>=999)", true},
+		{"(uidNumber<=999)", false},
+		{"(description=ein \\28test\\29)", true},
+		{"(description;lang-de=*)", true},
+		{"(description;lang-en=*)", false},
+		{"(mail=*)", false},
+	}
+
+	for _, v := range tests {
+		f, err := parseFilter(v.filter)
+		if err != nil {
+			t.Error(v.filter, err)
+			continue
+		}
+
+		if f.match(entry) != v.match {
+			t.Errorf("%v: expected match %v", v.filter, v.match)
+		}
+	}
+}
+
+func TestInvalidFilter(t *testing.T) {
+	for _, v := range []string{"", "cn=foo", "(cn=foo", "(=foo)", "(cn=foo))", "(cn=\\2)", "(&(cn=foo)"} {
+		_, err := parseFilter(v)
+		if err != ErrInvalidFilter {
+			t.Errorf("%q: expected ErrInvalidFilter, got %v", v, err)
+		}
+	}
+
+	_, err := parseFilter("(cn:caseExactMatch:=Fritz)")
+	if err != ErrUnsupported {
+		t.Error("expected ErrUnsupported for extensible match, got", err)
+	}
+}
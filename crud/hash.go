@@ -0,0 +1,324 @@
+package crud
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// Schemes for HashPassword. The hashed values are in the "{SCHEME}value" format of
+// RFC 2307 and can be stored in userPassword, e.g. if the server doesn't support the
+// password modify extended operation.
+const (
+	SchemeSSHA         = "SSHA"
+	SchemeSSHA256      = "SSHA256"
+	SchemeSSHA512      = "SSHA512"
+	SchemeCrypt        = "CRYPT" // sha512-crypt, "$6$"
+	SchemePBKDF2SHA512 = "PBKDF2-SHA512"
+)
+
+// length of generated salts in bytes
+const saltLength = 16
+
+// default number of rounds for sha512-crypt and PBKDF2-SHA512
+const (
+	cryptDefaultRounds  = 5000
+	pbkdf2DefaultRounds = 10000
+)
+
+// ErrUnknownScheme is returned for hashed passwords with an unsupported scheme.
+var ErrUnknownScheme = errors.New("Unknown password scheme.")
+
+// salted SHA schemes and their hash functions. The unsalted ones are only used for verification.
+var shaSchemes = map[string]func() hash.Hash{
+	"SHA":     sha1.New,
+	"SSHA":    sha1.New,
+	"SHA256":  sha256.New,
+	"SSHA256": sha256.New,
+	"SHA512":  sha512.New,
+	"SSHA512": sha512.New,
+}
+
+// HashPassword hashes password with scheme and a random salt.
+func HashPassword(scheme, password string) (string, error) {
+	salt := make([]byte, saltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	switch scheme {
+	case SchemeSSHA, SchemeSSHA256, SchemeSSHA512:
+		sum := saltedSum(shaSchemes[scheme], password, salt)
+		return fmt.Sprintf("{%v}%v", scheme, base64.StdEncoding.EncodeToString(append(sum, salt...))), nil
+	case SchemeCrypt:
+		// the salt of sha512-crypt consists of characters of the crypt alphabet
+		cryptSalt := cryptBase64(salt)[:16]
+		return "{CRYPT}" + sha512Crypt(password, cryptSalt, cryptDefaultRounds, false), nil
+	case SchemePBKDF2SHA512:
+		dk := pbkdf2([]byte(password), salt, pbkdf2DefaultRounds, sha512.Size, sha512.New)
+		return fmt.Sprintf("{%v}%v$%v$%v", scheme, pbkdf2DefaultRounds, adaptedBase64(salt), adaptedBase64(dk)), nil
+	}
+
+	return "", ErrUnknownScheme
+}
+
+// VerifyPassword reports if password matches the hashed password. Supported schemes are those
+// of HashPassword as well as the unsalted {SHA}, {SHA256} and {SHA512}.
+func VerifyPassword(hashed, password string) (bool, error) {
+	if !strings.HasPrefix(hashed, "{") || !strings.Contains(hashed, "}") {
+		return false, ErrUnknownScheme
+	}
+
+	end := strings.Index(hashed, "}")
+	scheme := strings.ToUpper(hashed[1:end])
+	value := hashed[end+1:]
+
+	switch scheme {
+	case "SHA", "SSHA", "SHA256", "SSHA256", "SHA512", "SSHA512":
+		h := shaSchemes[scheme]
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return false, err
+		}
+
+		size := h().Size()
+		if len(decoded) < size || (!strings.HasPrefix(scheme, "S") && len(decoded) != size) {
+			return false, errors.New("Invalid hashed password.")
+		}
+
+		sum := saltedSum(h, password, decoded[size:])
+		return subtle.ConstantTimeCompare(sum, decoded[:size]) == 1, nil
+	case SchemeCrypt:
+		salt, rounds, roundsSet, err := parseSha512Crypt(value)
+		if err != nil {
+			return false, err
+		}
+
+		computed := sha512Crypt(password, salt, rounds, roundsSet)
+		return subtle.ConstantTimeCompare([]byte(computed), []byte(value)) == 1, nil
+	case SchemePBKDF2SHA512:
+		fields := strings.Split(value, "$")
+		if len(fields) != 3 {
+			return false, errors.New("Invalid hashed password.")
+		}
+
+		rounds, err := strconv.Atoi(fields[0])
+		if err != nil || rounds < 1 {
+			return false, errors.New("Invalid hashed password.")
+		}
+
+		salt, err := decodeAdaptedBase64(fields[1])
+		if err != nil {
+			return false, err
+		}
+
+		expected, err := decodeAdaptedBase64(fields[2])
+		if err != nil {
+			return false, err
+		}
+
+		dk := pbkdf2([]byte(password), salt, rounds, len(expected), sha512.New)
+		return subtle.ConstantTimeCompare(dk, expected) == 1, nil
+	}
+
+	return false, ErrUnknownScheme
+}
+
+// saltedSum returns the hash of password followed by salt
+func saltedSum(h func() hash.Hash, password string, salt []byte) []byte {
+	d := h()
+	d.Write([]byte(password))
+	d.Write(salt)
+	return d.Sum(nil)
+}
+
+// pbkdf2 derives a key of keyLen bytes from password and salt (RFC 2898)
+func pbkdf2(password, salt []byte, rounds, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	size := prf.Size()
+
+	var dk []byte
+	for block := 1; len(dk) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+
+		t := make([]byte, size)
+		copy(t, u)
+
+		for i := 1; i < rounds; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		dk = append(dk, t...)
+	}
+
+	return dk[:keyLen]
+}
+
+// adaptedBase64 encodes b like the PBKDF2 schemes of OpenLDAP (and passlib) do:
+// standard base64 with "." instead of "+" and without padding.
+func adaptedBase64(b []byte) string {
+	return strings.Replace(base64.RawStdEncoding.EncodeToString(b), "+", ".", -1)
+}
+
+// decodeAdaptedBase64 decodes a string encoded with adaptedBase64
+func decodeAdaptedBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.Replace(strings.TrimRight(s, "="), ".", "+", -1))
+}
+
+// alphabet of the base64 variant used by crypt
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptBase64 encodes b with the crypt alphabet, in the usual order of bits
+func cryptBase64(b []byte) string {
+	return base64.NewEncoding(cryptAlphabet).WithPadding(base64.NoPadding).EncodeToString(b)
+}
+
+// parseSha512Crypt parses "$6$[rounds=N$]salt$hash" and returns the salt and the rounds
+func parseSha512Crypt(value string) (salt string, rounds int, roundsSet bool, err error) {
+	if !strings.HasPrefix(value, "$6$") {
+		return "", 0, false, errors.New("Unsupported crypt algorithm.")
+	}
+
+	fields := strings.Split(value[3:], "$")
+	rounds = cryptDefaultRounds
+
+	if len(fields) == 3 && strings.HasPrefix(fields[0], "rounds=") {
+		rounds, err = strconv.Atoi(fields[0][len("rounds="):])
+		if err != nil {
+			return "", 0, false, errors.New("Invalid hashed password.")
+		}
+		roundsSet = true
+		fields = fields[1:]
+	}
+
+	if len(fields) != 2 {
+		return "", 0, false, errors.New("Invalid hashed password.")
+	}
+
+	return fields[0], rounds, roundsSet, nil
+}
+
+// byte order of the final encoding of sha512-crypt
+var sha512CryptOrder = [][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+	{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13},
+	{56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41},
+}
+
+// sha512Crypt implements the SHA-512 based crypt by Ulrich Drepper
+// (https://www.akkadia.org/drepper/SHA-crypt.txt). If roundsSet is false, the rounds
+// are omitted from the result.
+func sha512Crypt(password, salt string, rounds int, roundsSet bool) string {
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	if rounds < 1000 {
+		rounds = 1000
+	} else if rounds > 999999999 {
+		rounds = 999999999
+	}
+
+	pw := []byte(password)
+	s := []byte(salt)
+
+	b := sha512.New()
+	b.Write(pw)
+	b.Write(s)
+	b.Write(pw)
+	sumB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(pw)
+	a.Write(s)
+	i := len(pw)
+	for ; i > 64; i -= 64 {
+		a.Write(sumB)
+	}
+	a.Write(sumB[:i])
+
+	for i = len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(sumB)
+		} else {
+			a.Write(pw)
+		}
+	}
+	sumA := a.Sum(nil)
+
+	dp := sha512.New()
+	for i = 0; i < len(pw); i++ {
+		dp.Write(pw)
+	}
+	p := bytes.Repeat(dp.Sum(nil), len(pw)/64+1)[:len(pw)]
+
+	ds := sha512.New()
+	for i = 0; i < 16+int(sumA[0]); i++ {
+		ds.Write(s)
+	}
+	sp := ds.Sum(nil)[:len(s)]
+
+	c := sumA
+	for r := 0; r < rounds; r++ {
+		h := sha512.New()
+		if r&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if r%3 != 0 {
+			h.Write(sp)
+		}
+		if r%7 != 0 {
+			h.Write(p)
+		}
+		if r&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("$6$")
+	if roundsSet {
+		fmt.Fprintf(&out, "rounds=%v$", rounds)
+	}
+	out.WriteString(salt)
+	out.WriteString("$")
+
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+
+	for _, v := range sha512CryptOrder {
+		encode(c[v[0]], c[v[1]], c[v[2]], 4)
+	}
+	encode(0, 0, c[63], 2)
+
+	return out.String()
+}
@@ -0,0 +1,83 @@
+package crud
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	for _, scheme := range []string{SchemeSSHA, SchemeSSHA256, SchemeSSHA512, SchemeCrypt, SchemePBKDF2SHA512} {
+		hashed, err := HashPassword(scheme, "foobar")
+		if err != nil {
+			t.Error(scheme, err)
+			continue
+		}
+
+		if !strings.HasPrefix(hashed, "{"+scheme+"}") {
+			t.Error("unexpected hashed password:", hashed)
+		}
+
+		ok, err := VerifyPassword(hashed, "foobar")
+		if err != nil || !ok {
+			t.Error("password didn't verify:", hashed, err)
+		}
+
+		ok, err = VerifyPassword(hashed, "foobaz")
+		if err != nil || ok {
+			t.Error("wrong password verified:", hashed, err)
+		}
+	}
+
+	_, err := HashPassword("MD5", "foobar")
+	if err != ErrUnknownScheme {
+		t.Error("Expected ErrUnknownScheme, got", err)
+	}
+}
+
+func TestSha512Crypt(t *testing.T) {
+	// test vectors from https://www.akkadia.org/drepper/SHA-crypt.txt
+	tests := []struct {
+		hashed   string
+		password string
+	}{
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!"},
+		{"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.", "Hello world!"},
+	}
+
+	for _, v := range tests {
+		ok, err := VerifyPassword("{CRYPT}"+v.hashed, v.password)
+		if err != nil || !ok {
+			t.Error("password didn't verify:", v.hashed, err)
+		}
+	}
+}
+
+func TestPbkdf2(t *testing.T) {
+	dk := pbkdf2([]byte("password"), []byte("salt"), 1, 64, sha512.New)
+
+	expected := "867f70cf1ade02cff3752599a3a53dc4af34c7a669815ae5d513554e1c8cf252c02d470a285a0501bad999bfe943c08f050235d7d68b1da55e63f73b60a57fce"
+	if hex.EncodeToString(dk) != expected {
+		t.Error("unexpected derived key:", hex.EncodeToString(dk))
+	}
+}
+
+func TestVerifyPasswordSHA(t *testing.T) {
+	// sha1("secret" + "\x01\x02\x03\x04") followed by the salt
+	ok, err := VerifyPassword("{SSHA}uJDd0BIdJ9Z7yDCZNWdgYeb33+cBAgME", "secret")
+	if err != nil || !ok {
+		t.Error("salted password didn't verify:", err)
+	}
+
+	// sha1("password")
+	ok, err = VerifyPassword("{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password")
+	if err != nil || !ok {
+		t.Error("unsalted password didn't verify:", err)
+	}
+
+	_, err = VerifyPassword("foobar", "foobar")
+	if err != ErrUnknownScheme {
+		t.Error("Expected ErrUnknownScheme, got", err)
+	}
+}
@@ -0,0 +1,109 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+)
+
+// Items may implement the following interfaces to be called by the Manager during its
+// operations, e.g. to derive attributes from others, set defaults or refuse changes.
+// An error returned by a hook aborts the operation with that error.
+
+// A BeforeCreater is called by Create before the Item is validated and marshalled.
+type BeforeCreater interface {
+	BeforeCreate() error
+}
+
+// An AfterCreater is called by Create after the entry was added. It isn't called in dry
+// run mode, as no entry is added.
+type AfterCreater interface {
+	AfterCreate() error
+}
+
+// A BeforeUpdater is called by Update before the Item is validated and compared with old,
+// the Item as currently stored.
+type BeforeUpdater interface {
+	BeforeUpdate(old Item) error
+}
+
+// An AfterReader is called whenever the Item was unmarshalled from an entry read from
+// the server, by Read, ReadAll, Watch and the pre- and post-read controls, as well as
+// by Cache and Replica.
+type AfterReader interface {
+	AfterRead() error
+}
+
+// A BeforeDeleter is called by Delete and DeleteSubtree before deleting the entry.
+// DeleteSubtree only calls it for the Item passed to it, not for the entries below.
+type BeforeDeleter interface {
+	BeforeDelete() error
+}
+
+// A Validator is called by Create and Update after BeforeCreate and BeforeUpdate.
+type Validator interface {
+	Validate() error
+}
+
+// unmarshal unmarshals entry into item and calls its AfterRead hook
+func unmarshal(item Item, entry *ldap.Entry) error {
+	err := item.UnmarshalLDAP(entry)
+	if err != nil {
+		return err
+	}
+
+	if h, ok := item.(AfterReader); ok {
+		return h.AfterRead()
+	}
+
+	return nil
+}
+
+// beforeCreate calls the BeforeCreate and Validate hooks of item
+func beforeCreate(item Item) error {
+	if h, ok := item.(BeforeCreater); ok {
+		err := h.BeforeCreate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return validate(item)
+}
+
+// afterCreate calls the AfterCreate hook of item
+func afterCreate(item Item) error {
+	if h, ok := item.(AfterCreater); ok {
+		return h.AfterCreate()
+	}
+
+	return nil
+}
+
+// beforeUpdate calls the BeforeUpdate and Validate hooks of item
+func beforeUpdate(item, old Item) error {
+	if h, ok := item.(BeforeUpdater); ok {
+		err := h.BeforeUpdate(old)
+		if err != nil {
+			return err
+		}
+	}
+
+	return validate(item)
+}
+
+// beforeDelete calls the BeforeDelete hook of item
+func beforeDelete(item Item) error {
+	if h, ok := item.(BeforeDeleter); ok {
+		return h.BeforeDelete()
+	}
+
+	return nil
+}
+
+// validate calls the Validate hook of item
+func validate(item Item) error {
+	if h, ok := item.(Validator); ok {
+		return h.Validate()
+	}
+
+	return nil
+}
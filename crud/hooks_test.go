@@ -0,0 +1,170 @@
+package crud
+
+import (
+	"bytes"
+	"errors"
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+	"strings"
+	"testing"
+)
+
+var errServiceAccount = errors.New("service accounts can't be deleted")
+
+// hookedUser derives cn and displayName, defaults loginShell and refuses deletion of
+// service accounts
+type hookedUser struct {
+	*Dynamic
+	read    bool
+	created bool
+}
+
+func (u *hookedUser) Copy() Item {
+	return &hookedUser{Dynamic: u.Dynamic.Copy().(*Dynamic)}
+}
+
+func (u *hookedUser) derive() {
+	name := u.GetValue("givenName") + " " + u.GetValue("sn")
+	u.Set("cn", name)
+	u.Set("displayName", name)
+}
+
+func (u *hookedUser) BeforeCreate() error {
+	u.derive()
+	if !u.Has("loginShell") {
+		u.Set("loginShell", "/bin/bash")
+	}
+
+	return nil
+}
+
+func (u *hookedUser) BeforeUpdate(old Item) error {
+	u.derive()
+	if !u.Has("loginShell") {
+		u.Set("loginShell", old.(*hookedUser).Get("loginShell")...)
+	}
+
+	return nil
+}
+
+func (u *hookedUser) AfterCreate() error {
+	u.created = true
+	return nil
+}
+
+func (u *hookedUser) AfterRead() error {
+	u.read = true
+	return nil
+}
+
+func (u *hookedUser) BeforeDelete() error {
+	if u.GetValue("employeeType") == "service" {
+		return errServiceAccount
+	}
+
+	return nil
+}
+
+func (u *hookedUser) Validate() error {
+	if u.GetValue("sn") == "" {
+		return errors.New("sn missing")
+	}
+
+	return nil
+}
+
+func newHookedUser(givenName, sn string) *hookedUser {
+	u := &hookedUser{Dynamic: NewDynamic("uid=" + strings.ToLower(givenName))}
+	u.Set("objectClass", "inetOrgPerson")
+	u.Set("givenName", givenName)
+	u.Set("sn", sn)
+	return u
+}
+
+func TestHooks(t *testing.T) {
+	var b bytes.Buffer
+
+	// answer reads with the entry of Fritz Foobar
+	stored := ldap.NewEntry("uid=fritz")
+	stored.AddAttributeValues("objectClass", []string{"inetOrgPerson"})
+	stored.AddAttributeValues("givenName", []string{"Fritz"})
+	stored.AddAttributeValues("sn", []string{"Foobar"})
+	stored.AddAttributeValues("cn", []string{"Fritz Foobar"})
+	stored.AddAttributeValues("displayName", []string{"Fritz Foobar"})
+	stored.AddAttributeValues("loginShell", []string{"/bin/zsh"})
+
+	c := New(nil, "").DryRun(ldif.NewWriter(&b)).WithInterceptors(func(inv *Invocation, next Handler) error {
+		if inv.Operation == OperationRead {
+			inv.Entries = []*ldap.Entry{copyEntry(stored)}
+			return nil
+		}
+
+		return next(inv)
+	})
+
+	u := newHookedUser("Fritz", "Foobar")
+	err := c.Create(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.GetValue("displayName") != "Fritz Foobar" || u.GetValue("loginShell") != "/bin/bash" {
+		t.Errorf("unexpected attributes after create: %v %v", u.Get("displayName"), u.Get("loginShell"))
+	}
+
+	if u.created {
+		t.Error("expected AfterCreate not to be called in dry run mode")
+	}
+
+	err = c.Create(newHookedUser("Gonzo", ""))
+	if err == nil || err.Error() != "sn missing" {
+		t.Error("expected validation error, got", err)
+	}
+
+	read := newHookedUser("Fritz", "")
+	err = c.Read(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !read.read {
+		t.Error("expected AfterRead to be called")
+	}
+
+	b.Reset()
+	u = newHookedUser("Fritz", "Gonzo")
+	err = c.Update(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cn and displayName are derived, the loginShell is kept
+	expected := "\ndn: uid=fritz\nchangetype: modify\nreplace: sn\nsn: Gonzo\n-\n" +
+		"replace: cn\ncn: Fritz Gonzo\n-\nreplace: displayName\ndisplayName: Fritz Gonzo\n-\n"
+	if b.String() != expected {
+		t.Errorf("unexpected LDIF:\n%v", b.String())
+	}
+
+	u.Set("employeeType", "service")
+	err = c.Delete(u)
+	if err != errServiceAccount {
+		t.Error("expected delete to be refused, got", err)
+	}
+}
+
+func TestAfterCreate(t *testing.T) {
+	// pretend the entry was added
+	c := New(nil, "").WithInterceptors(func(inv *Invocation, next Handler) error {
+		return nil
+	})
+
+	u := newHookedUser("Fritz", "Foobar")
+	err := c.Create(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !u.created {
+		t.Error("expected AfterCreate to be called")
+	}
+}
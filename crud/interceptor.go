@@ -0,0 +1,118 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+)
+
+// Operation is the kind of operation an Interceptor is called for.
+type Operation int
+
+const (
+	OperationCreate Operation = iota
+	OperationRead
+	OperationReadAll
+	OperationCompare
+	OperationUpdate
+	OperationDelete
+	OperationDeleteSubtree
+	OperationRename
+	OperationPasswd
+)
+
+func (o Operation) String() string {
+	switch o {
+	case OperationCreate:
+		return "create"
+	case OperationRead:
+		return "read"
+	case OperationReadAll:
+		return "readAll"
+	case OperationCompare:
+		return "compare"
+	case OperationUpdate:
+		return "update"
+	case OperationDelete:
+		return "delete"
+	case OperationDeleteSubtree:
+		return "deleteSubtree"
+	case OperationRename:
+		return "rename"
+	case OperationPasswd:
+		return "passwd"
+	}
+
+	return "unknown"
+}
+
+// An Invocation describes an operation of a Manager passed through its interceptors.
+type Invocation struct {
+	Operation Operation
+
+	// DN the operation is done on with the base DN appended, the search base for ReadAll
+	Dn string
+
+	// Item the operation is done for. nil for ReadAllRegistry, for records applied with
+	// ApplyLDIF and for password changes of the bound user.
+	Item Item
+
+	// Item as read before an update, nil for other operations
+	Old Item
+
+	// Request sent to the server: *ldap.AddRequest for create, *ldap.SearchRequest for
+	// read and readAll, *ldap.CompareRequest for compare, *ldap.ModifyRequest for update,
+	// *ldap.DeleteRequest for delete and *ldap.ModifyDNRequest for rename. Interceptors
+	// may modify it before calling the next handler. nil for deleteSubtree and passwd,
+	// which may need several requests.
+	Request interface{}
+
+	// Entries found by read and readAll, with the base DN removed, set when the handler
+	// returns. Interceptors may modify them before returning.
+	Entries []*ldap.Entry
+
+	// Result of compare, set when the handler returns
+	Compared bool
+
+	// Password generated by the server for passwd, set when the handler returns
+	Generated string
+
+	// Manager performing the operation. Operations done with it pass through its
+	// interceptors as well.
+	Manager *Manager
+}
+
+// A Handler performs the operation described by an Invocation.
+type Handler func(inv *Invocation) error
+
+// An Interceptor is called for every operation of a Manager instead of the Handler
+// performing it. It may inspect or modify the Invocation, call next to continue with
+// the next Interceptor or the operation itself, and inspect the results afterwards.
+// Returning without calling next skips the operation, e.g. to refuse it with an error.
+type Interceptor func(inv *Invocation, next Handler) error
+
+// WithInterceptors returns a Manager passing all operations through interceptors, in
+// addition to the interceptors of c. The first Interceptor is called first. The returned
+// Manager shares the connection of c.
+//
+// Interceptors are called for Create, Read, ReadAll, Compare, Update, Delete,
+// DeleteSubtree and PasswdModify, the methods built on them, and for the records applied
+// with ApplyLDIF, not for the single requests an operation consists of. Update reads the
+// entry before modifying it, so interceptors are called for the read as well.
+func (c *Manager) WithInterceptors(interceptors ...Interceptor) *Manager {
+	d := c.derive()
+	d.interceptors = append(d.interceptors, interceptors...)
+	return d
+}
+
+// intercept passes inv through the interceptors of the Manager and handler
+func (c *Manager) intercept(inv *Invocation, handler Handler) error {
+	inv.Manager = c
+
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := c.interceptors[i], handler
+		handler = func(inv *Invocation) error {
+			return interceptor(inv, next)
+		}
+	}
+
+	return handler(inv)
+}
@@ -0,0 +1,89 @@
+package crud
+
+import (
+	"bytes"
+	"errors"
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	var b bytes.Buffer
+	var calls []string
+
+	trace := func(name string) Interceptor {
+		return func(inv *Invocation, next Handler) error {
+			calls = append(calls, name+" "+inv.Operation.String()+" "+inv.Dn)
+			return next(inv)
+		}
+	}
+
+	errRefused := errors.New("refused")
+	c := New(nil, "dc=example,dc=com").DryRun(ldif.NewWriter(&b)).WithInterceptors(trace("first"), trace("second"))
+	c = c.WithInterceptors(func(inv *Invocation, next Handler) error {
+		switch inv.Operation {
+		case OperationCreate:
+			// modify the request
+			addRequest := inv.Request.(*ldap.AddRequest)
+			addRequest.Entry.AddAttributeValue("description", "intercepted")
+		case OperationDelete:
+			// short-circuit with an error
+			return errRefused
+		case OperationRead:
+			// short-circuit with a result
+			entry := ldap.NewEntry("ou=Groups")
+			entry.AddAttributeValues("ou", []string{"Groups"})
+			inv.Entries = []*ldap.Entry{entry}
+			return nil
+		}
+
+		return next(inv)
+	})
+
+	err := c.Create(&OrganizationalUnit{dn: "ou=Groups", ou: []string{"Groups"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(b.String(), "description: intercepted\n") {
+		t.Errorf("expected modified request, got:\n%v", b.String())
+	}
+
+	err = c.Delete(&OrganizationalUnit{dn: "ou=Groups"})
+	if err != errRefused {
+		t.Error("expected error of interceptor, got", err)
+	}
+
+	if strings.Contains(b.String(), "changetype: delete") {
+		t.Error("expected delete to be skipped")
+	}
+
+	ou := &OrganizationalUnit{dn: "ou=Groups"}
+	err = c.Read(ou)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equalStringSlice(ou.ou, []string{"Groups"}) {
+		t.Error("unexpected ou:", ou.ou)
+	}
+
+	expected := []string{
+		"first create ou=Groups,dc=example,dc=com",
+		"second create ou=Groups,dc=example,dc=com",
+		"first delete ou=Groups,dc=example,dc=com",
+		"second delete ou=Groups,dc=example,dc=com",
+		"first read ou=Groups,dc=example,dc=com",
+		"second read ou=Groups,dc=example,dc=com",
+	}
+
+	if !equalStringSlice(calls, expected) {
+		t.Errorf("unexpected calls: %q", calls)
+	}
+
+	if len(New(nil, "").interceptors) != 0 || len(c.derive().interceptors) != 3 {
+		t.Error("unexpected interceptors of derived Managers")
+	}
+}
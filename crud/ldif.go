@@ -0,0 +1,102 @@
+package crud
+
+import (
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+	"log"
+)
+
+// WriteLDIF writes items as LDIF content records to w, with the base DN appended to
+// their DNs. Items keeping all attributes, like Dynamic, hold operational attributes if
+// read with a Manager returned by WithOperationalAttributes. They are written if
+// w.Operational is set.
+func (c *Manager) WriteLDIF(w *ldif.Writer, items ...Item) error {
+	for _, v := range items {
+		entry, err := v.MarshalLDAP()
+		if err != nil {
+			return err
+		}
+		entry.DN = c.appendBaseDn(v.Dn())
+
+		err = w.WriteEntry(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplyLDIF reads the records from r and applies them in order, adding content records.
+// The DNs of the records are used as they are, without appending the base DN. The
+// result of every record read is returned. Unless continueOnError is set, ApplyLDIF
+// stops at the first record which fails.
+func (c *Manager) ApplyLDIF(r *ldif.Reader, continueOnError bool) ([]ldif.Result, error) {
+	return ldif.Apply(ldifExecutor{c}, r, continueOnError)
+}
+
+// ldifExecutor sends the requests of LDIF records like the other requests of the Manager,
+// passing them through its interceptors
+type ldifExecutor struct {
+	c *Manager
+}
+
+func (e ldifExecutor) Add(addRequest *ldap.AddRequest) error {
+	addRequest.Controls = e.c.requestControls(addRequest.Controls...)
+
+	inv := &Invocation{Operation: OperationCreate, Dn: addRequest.Entry.DN, Request: addRequest}
+	return e.c.intercept(inv, func(inv *Invocation) error {
+		addRequest := inv.Request.(*ldap.AddRequest)
+
+		if e.c.Debug {
+			log.Println("Add request:", addRequest)
+		}
+
+		return e.c.doAdd(addRequest)
+	})
+}
+
+func (e ldifExecutor) Modify(modifyRequest *ldap.ModifyRequest) error {
+	modifyRequest.Controls = e.c.requestControls(modifyRequest.Controls...)
+
+	inv := &Invocation{Operation: OperationUpdate, Dn: modifyRequest.DN, Request: modifyRequest}
+	return e.c.intercept(inv, func(inv *Invocation) error {
+		modifyRequest := inv.Request.(*ldap.ModifyRequest)
+
+		if e.c.Debug {
+			log.Println("Modify request:", modifyRequest)
+		}
+
+		return e.c.doModify(modifyRequest)
+	})
+}
+
+func (e ldifExecutor) Delete(deleteRequest *ldap.DeleteRequest) error {
+	deleteRequest.Controls = e.c.requestControls(deleteRequest.Controls...)
+
+	inv := &Invocation{Operation: OperationDelete, Dn: deleteRequest.DN, Request: deleteRequest}
+	return e.c.intercept(inv, func(inv *Invocation) error {
+		deleteRequest := inv.Request.(*ldap.DeleteRequest)
+
+		if e.c.Debug {
+			log.Println("Delete request:", deleteRequest)
+		}
+
+		return e.c.doDelete(deleteRequest)
+	})
+}
+
+func (e ldifExecutor) ModifyDN(modifyDNRequest *ldap.ModifyDNRequest) error {
+	modifyDNRequest.Controls = e.c.requestControls(modifyDNRequest.Controls...)
+
+	inv := &Invocation{Operation: OperationRename, Dn: modifyDNRequest.DN, Request: modifyDNRequest}
+	return e.c.intercept(inv, func(inv *Invocation) error {
+		modifyDNRequest := inv.Request.(*ldap.ModifyDNRequest)
+
+		if e.c.Debug {
+			log.Println("Modify DN request:", modifyDNRequest)
+		}
+
+		return e.c.doModifyDN(modifyDNRequest)
+	})
+}
@@ -0,0 +1,34 @@
+package crud
+
+import (
+	"bytes"
+	"github.com/bytemine/ldap-crud/ldif"
+	"testing"
+)
+
+func TestWriteLDIF(t *testing.T) {
+	c := New(nil, "dc=example,dc=com")
+
+	d := NewDynamic("ou=People")
+	d.Set("objectClass", "organizationalUnit")
+	d.Set("ou", "People")
+	d.Set("createTimestamp", "20240101000000Z")
+
+	var b bytes.Buffer
+	err := c.WriteLDIF(ldif.NewWriter(&b), d, &OrganizationalUnit{dn: "ou=Groups", ou: []string{"Groups"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "version: 1\n\n" +
+		"dn: ou=People,dc=example,dc=com\nobjectClass: organizationalUnit\nou: People\n\n" +
+		"dn: ou=Groups,dc=example,dc=com\nobjectClass: organizationalUnit\nou: Groups\n"
+
+	if b.String() != expected {
+		t.Errorf("unexpected LDIF:\n%v", b.String())
+	}
+
+	if !New(nil, "").WithOperationalAttributes().operational {
+		t.Error("expected operational attributes to be requested")
+	}
+}
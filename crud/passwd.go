@@ -0,0 +1,219 @@
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rbns/ldap"
+	"log"
+	"strings"
+)
+
+// OID of the password modify extended operation (RFC 3062)
+const oidPasswdModify = "1.3.6.1.4.1.4203.1.11.1"
+
+// ErrPasswordConstraint is the reason of a PasswdError if the new password violates the
+// password policy of the server, e.g. because it is too short or was used before.
+var ErrPasswordConstraint = errors.New("Password violates constraints.")
+
+// ErrInsufficientAccess is the reason of a PasswdError if the bound user may not change
+// the password.
+var ErrInsufficientAccess = errors.New("Insufficient access.")
+
+// ErrPasswdRefused is the reason of a PasswdError if the server refused the password change
+// for other reasons, e.g. because the old password was required but not given.
+var ErrPasswdRefused = errors.New("Password change refused.")
+
+// A PasswdError is returned if the server refused a password change.
+type PasswdError struct {
+	// Reason of the refusal: ErrPasswordConstraint, ErrInvalidCredentials (the old password
+	// is wrong), ErrInsufficientAccess or ErrPasswdRefused. If the server sent a password
+	// policy response control, the PasswordPolicyError of the response.
+	Reason error
+
+	// Diagnostic message of the server
+	Message string
+}
+
+func (e *PasswdError) Error() string {
+	return fmt.Sprintf("%v %v", e.Reason, e.Message)
+}
+
+// passwdError maps the error of a refused password modify operation to a PasswdError. Other
+// errors are returned unmodified.
+func passwdError(err error) error {
+	code, ok := resultCode(err)
+	if !ok {
+		return err
+	}
+
+	var reason error
+	switch code {
+	case resultConstraintViolation:
+		reason = ErrPasswordConstraint
+	case resultInvalidCredentials:
+		reason = ErrInvalidCredentials
+	case resultInsufficientAccessRights:
+		reason = ErrInsufficientAccess
+	case resultUnwillingToPerform:
+		reason = ErrPasswdRefused
+	default:
+		return err
+	}
+
+	// without a diagnostic message, the text of the result code is used
+	message := err.Error()
+	if ldapErr := err.(*ldap.Error); ldapErr.Err != nil {
+		message = ldapErr.Err.Error()
+	}
+
+	return &PasswdError{Reason: reason, Message: message}
+}
+
+// PasswdModify changes the password of item with the password modify extended operation
+// (RFC 3062). If item is nil, the password of the bound user is changed.
+//
+// If oldPasswd isn't empty, it is sent to the server, which verifies it before changing the
+// password. If newPasswd is empty, the server generates a new password, which is returned.
+//
+// If the server refuses the change, a *PasswdError describing the reason is returned.
+//
+// If the server answers that it doesn't support the extended operation, ErrUnsupported is
+// returned, unless PasswdReplaceFallback is set. Then userPassword is replaced with newPasswd
+// hashed with PasswordScheme instead, also if the root DSE doesn't list the extended
+// operation. The old password is verified by binding with it, which requires a Pool, and
+// generating passwords isn't possible.
+func (c *Manager) PasswdModify(item Item, oldPasswd, newPasswd string) (string, error) {
+	inv := &Invocation{Operation: OperationPasswd, Item: item}
+	if item != nil {
+		inv.Dn = c.appendBaseDn(item.Dn())
+	}
+
+	err := c.intercept(inv, func(inv *Invocation) error {
+		var err error
+		inv.Generated, err = c.passwdModify(item, oldPasswd, newPasswd)
+		return err
+	})
+
+	return inv.Generated, err
+}
+
+// passwdModify changes the password as described for PasswdModify
+func (c *Manager) passwdModify(item Item, oldPasswd, newPasswd string) (string, error) {
+	if c.PasswdReplaceFallback && !c.supportsExtension(oidPasswdModify) {
+		return "", c.passwdReplace(item, oldPasswd, newPasswd)
+	}
+
+	var fields [][]byte
+	if item != nil {
+		fields = append(fields, berEncodeString(berContext|0, c.appendBaseDn(item.Dn())))
+	}
+	if oldPasswd != "" {
+		fields = append(fields, berEncodeString(berContext|1, oldPasswd))
+	}
+	if newPasswd != "" {
+		fields = append(fields, berEncodeString(berContext|2, newPasswd))
+	}
+
+	extendedRequest := &ldap.ExtendedRequest{
+		Name:     oidPasswdModify,
+		Value:    string(berEncodeSequence(berSequence, fields...)),
+		Controls: c.requestControls(newPasswordPolicyControl()),
+	}
+
+	if c.Debug {
+		log.Println("Password Request:", extendedRequest)
+	}
+
+	response, err := c.doExtended(extendedRequest)
+
+	// servers answer unknown extended operations with protocolError or unavailable
+	if code, ok := resultCode(err); ok && (code == resultProtocolError || code == resultUnavailable) {
+		if !c.PasswdReplaceFallback {
+			return "", ErrUnsupported
+		}
+
+		return "", c.passwdReplace(item, oldPasswd, newPasswd)
+	}
+
+	if err != nil {
+		err = passwdError(err)
+
+		// the password policy response tells more precisely what was wrong
+		if passwdErr, ok := err.(*PasswdError); ok && response != nil {
+			policy, perr := parsePasswordPolicy(response.Controls)
+			if perr == nil && policy != nil && policy.Err != nil {
+				passwdErr.Reason = policy.Err
+			}
+		}
+
+		return "", err
+	}
+
+	if response.Value == "" {
+		return "", nil
+	}
+
+	// PasswdModifyResponseValue ::= SEQUENCE { genPasswd [0] OCTET STRING OPTIONAL }
+	value, err := berDecodeSingle([]byte(response.Value))
+	if err != nil {
+		return "", err
+	}
+
+	fieldElements, err := value.children()
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range fieldElements {
+		if v.tag == berContext|0 {
+			return v.string(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// passwdReplace changes the password by replacing userPassword with a hash of newPasswd.
+func (c *Manager) passwdReplace(item Item, oldPasswd, newPasswd string) error {
+	if newPasswd == "" || (oldPasswd != "" && c.Pool == nil) {
+		return ErrUnsupported
+	}
+
+	var dn string
+	if item != nil {
+		dn = c.appendBaseDn(item.Dn())
+	} else {
+		authzId, err := c.WhoAmI()
+		if err != nil {
+			return err
+		}
+
+		if !strings.HasPrefix(authzId, "dn:") {
+			return ErrUnsupported
+		}
+
+		dn = strings.TrimPrefix(authzId, "dn:")
+	}
+
+	if oldPasswd != "" {
+		err := c.Authenticate(NewDynamic(c.removeBaseDn(dn)), oldPasswd)
+		if err != nil {
+			return err
+		}
+	}
+
+	hash, err := HashPassword(c.PasswordScheme, newPasswd)
+	if err != nil {
+		return err
+	}
+
+	modifyRequest := ldap.NewModifyRequest(dn)
+	modifyRequest.Controls = c.requestControls()
+	modifyRequest.AddMod(ldap.NewMod(ldap.ModReplace, "userPassword", []string{hash}))
+
+	if c.Debug {
+		log.Println("Modify request:", dn, "userPassword")
+	}
+
+	return passwdError(c.doModify(modifyRequest))
+}
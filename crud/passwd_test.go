@@ -0,0 +1,56 @@
+package crud
+
+import (
+	"bytes"
+	"errors"
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+	"strings"
+	"testing"
+)
+
+func TestPasswdError(t *testing.T) {
+	err := passwdError(&ldap.Error{ResultCode: resultConstraintViolation, Err: errors.New("Password fails quality checking policy")})
+
+	passwdErr, ok := err.(*PasswdError)
+	if !ok || passwdErr.Reason != ErrPasswordConstraint || passwdErr.Message != "Password fails quality checking policy" {
+		t.Error("unexpected error:", err)
+	}
+
+	// the server may send no diagnostic message
+	err = passwdError(&ldap.Error{ResultCode: resultInvalidCredentials})
+	if passwdErr, ok := err.(*PasswdError); !ok || passwdErr.Reason != ErrInvalidCredentials {
+		t.Error("unexpected error:", err)
+	}
+
+	err = passwdError(&ldap.Error{ResultCode: resultNoSuchObject, Err: errors.New("")})
+	if _, ok := err.(*PasswdError); ok {
+		t.Error("noSuchObject was mapped to a PasswdError")
+	}
+}
+
+func TestPasswdModifyUnsupported(t *testing.T) {
+	var b bytes.Buffer
+	c := New(nil, "dc=example,dc=com").DryRun(ldif.NewWriter(&b))
+	c.rootDSE.rootDSE = &RootDSE{}
+
+	// the extended operation is sent even if the root DSE doesn't list it
+	_, err := c.PasswdModify(&fritzFoobarPerson, "", "foobaz")
+	if err != ErrDryRun {
+		t.Error("Expected ErrDryRun, got", err)
+	}
+
+	if b.Len() != 0 {
+		t.Errorf("userPassword was replaced without fallback:\n%v", b.String())
+	}
+
+	c.PasswdReplaceFallback = true
+	_, err = c.PasswdModify(&fritzFoobarPerson, "", "foobaz")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !strings.Contains(b.String(), "replace: userPassword\n") {
+		t.Errorf("unexpected LDIF:\n%v", b.String())
+	}
+}
@@ -0,0 +1,89 @@
+package crud
+
+import (
+	"errors"
+	"github.com/rbns/ldap"
+	"sync"
+)
+
+// A DialFunc returns a new connected connection.
+type DialFunc func() (*ldap.Connection, error)
+
+// A Pool keeps connections for reuse. Connections are created on demand by the
+// DialFunc of the Pool, at most size idle connections are kept.
+//
+// Connections returned by a Pool are in the state they were put back in, so
+// users of a Pool must bind them as needed.
+type Pool struct {
+	dial DialFunc
+	idle chan *ldap.Connection
+
+	// guards closing idle, as Put may still be called afterwards
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewPool creates a Pool keeping at most size idle connections created with dial.
+func NewPool(dial DialFunc, size int) *Pool {
+	return &Pool{dial: dial, idle: make(chan *ldap.Connection, size)}
+}
+
+// Get returns an idle connection, or a new one if there is no idle connection.
+func (p *Pool) Get() (*ldap.Connection, error) {
+	select {
+	case conn, ok := <-p.idle:
+		if !ok {
+			return nil, errors.New("Pool is closed.")
+		}
+		return conn, nil
+	default:
+		return p.dial()
+	}
+}
+
+// Put returns conn to the pool. If the pool already holds the maximum number of idle
+// connections or is closed, conn is closed.
+func (p *Pool) Put(conn *ldap.Connection) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		conn.Close()
+		return
+	}
+
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Discard closes conn instead of returning it to the pool, e.g. because
+// the connection broke.
+func (p *Pool) Discard(conn *ldap.Connection) {
+	conn.Close()
+}
+
+// Close closes all idle connections. The pool can't be used afterwards, connections
+// put back are closed.
+func (p *Pool) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	p.closed = true
+	close(p.idle)
+
+	var err error
+	for conn := range p.idle {
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,112 @@
+package crud
+
+import (
+	"fmt"
+	"github.com/rbns/ldap"
+	"time"
+)
+
+// OID of the password policy control (draft-behera-ldap-password-policy)
+const oidPasswordPolicy = "1.3.6.1.4.1.42.2.27.8.5.1"
+
+// A PasswordPolicyError is an error state reported by the server in the password policy
+// response control.
+type PasswordPolicyError int
+
+// Error states of the password policy response control
+const (
+	PasswordExpired PasswordPolicyError = iota
+	AccountLocked
+	ChangeAfterReset
+	PasswordModNotAllowed
+	MustSupplyOldPassword
+	InsufficientPasswordQuality
+	PasswordTooShort
+	PasswordTooYoung
+	PasswordInHistory
+)
+
+var passwordPolicyErrors = map[PasswordPolicyError]string{
+	PasswordExpired:             "Password expired.",
+	AccountLocked:               "Account locked.",
+	ChangeAfterReset:            "Password must be changed after reset.",
+	PasswordModNotAllowed:       "Password modification not allowed.",
+	MustSupplyOldPassword:       "Old password must be supplied.",
+	InsufficientPasswordQuality: "Insufficient password quality.",
+	PasswordTooShort:            "Password too short.",
+	PasswordTooYoung:            "Password changed too recently.",
+	PasswordInHistory:           "Password was used before.",
+}
+
+func (e PasswordPolicyError) Error() string {
+	if msg, ok := passwordPolicyErrors[e]; ok {
+		return msg
+	}
+
+	return fmt.Sprintf("Password policy error %d.", int(e))
+}
+
+// PasswordPolicy holds the contents of a password policy response control.
+type PasswordPolicy struct {
+	// Time until the password expires. Zero if the server sent no such warning.
+	TimeBeforeExpiration time.Duration
+
+	// Number of remaining logins with the expired password. -1 if the server sent
+	// no such warning.
+	GraceAuthNsRemaining int
+
+	// Error state, a PasswordPolicyError. nil if the server reported no error.
+	Err error
+}
+
+// newPasswordPolicyControl returns a password policy request control
+func newPasswordPolicyControl() ldap.Control {
+	return ldap.NewControlString(oidPasswordPolicy, false, "")
+}
+
+// parsePasswordPolicy returns the password policy response control of controls, or nil
+// if there is none.
+func parsePasswordPolicy(controls []ldap.Control) (*PasswordPolicy, error) {
+	value, ok := findControl(controls, oidPasswordPolicy)
+	if !ok {
+		return nil, nil
+	}
+
+	policy := &PasswordPolicy{GraceAuthNsRemaining: -1}
+
+	// PasswordPolicyResponseValue ::= SEQUENCE {
+	//    warning [0] CHOICE {
+	//       timeBeforeExpiration [0] INTEGER (0 .. maxInt),
+	//       graceAuthNsRemaining [1] INTEGER (0 .. maxInt) } OPTIONAL,
+	//    error   [1] ENUMERATED { ... } OPTIONAL }
+	sequence, err := berDecodeSingle([]byte(value))
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := sequence.children()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range fields {
+		switch v.tag {
+		case berContext | berConstructed | 0:
+			warning, err := berDecodeSingle(v.content)
+			if err != nil {
+				return nil, err
+			}
+
+			switch warning.tag {
+			case berContext | 0:
+				policy.TimeBeforeExpiration = time.Duration(warning.int()) * time.Second
+			case berContext | 1:
+				policy.GraceAuthNsRemaining = int(warning.int())
+			}
+		case berContext | 1:
+			policy.Err = PasswordPolicyError(v.int())
+		}
+	}
+
+	return policy, nil
+}
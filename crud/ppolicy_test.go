@@ -0,0 +1,41 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"testing"
+	"time"
+)
+
+func TestParsePasswordPolicy(t *testing.T) {
+	// warning timeBeforeExpiration 3600
+	value := berEncodeSequence(berSequence,
+		berEncodeSequence(berContext|berConstructed|0, berEncodeInt(berContext|0, 3600)))
+
+	policy, err := parsePasswordPolicy([]ldap.Control{ldap.NewControlString(oidPasswordPolicy, false, string(value))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.TimeBeforeExpiration != time.Hour || policy.GraceAuthNsRemaining != -1 || policy.Err != nil {
+		t.Error("unexpected password policy:", policy)
+	}
+
+	// warning graceAuthNsRemaining 0, error passwordExpired
+	value = berEncodeSequence(berSequence,
+		berEncodeSequence(berContext|berConstructed|0, berEncodeInt(berContext|1, 0)),
+		berEncodeInt(berContext|1, int64(PasswordExpired)))
+
+	policy, err = parsePasswordPolicy([]ldap.Control{ldap.NewControlString(oidPasswordPolicy, false, string(value))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.GraceAuthNsRemaining != 0 || policy.Err != PasswordExpired {
+		t.Error("unexpected password policy:", policy)
+	}
+
+	policy, err = parsePasswordPolicy(nil)
+	if policy != nil || err != nil {
+		t.Error("password policy parsed without control")
+	}
+}
@@ -0,0 +1,150 @@
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rbns/ldap"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Servers like Active Directory return only a part of the values of huge multi-valued
+// attributes, e.g. "member;range=0-1499" instead of "member". The remaining values have
+// to be retrieved by requesting further ranges (see
+// https://tools.ietf.org/html/draft-kashi-incremental-00).
+
+// parseRange returns the range of an attribute description with a range option. last is
+// true if the range is the last one. ok is false if the description has no range option.
+func parseRange(desc AttributeDescription) (low, high int, last, ok bool, err error) {
+	for _, v := range desc.Options {
+		if !strings.HasPrefix(strings.ToLower(v), "range=") {
+			continue
+		}
+
+		bounds := strings.SplitN(v[len("range="):], "-", 2)
+		if len(bounds) != 2 {
+			return 0, 0, false, true, fmt.Errorf("Invalid range option: %v", v)
+		}
+
+		low, err = strconv.Atoi(bounds[0])
+		if err != nil {
+			return 0, 0, false, true, fmt.Errorf("Invalid range option: %v", v)
+		}
+
+		if bounds[1] == "*" {
+			return low, 0, true, true, nil
+		}
+
+		high, err = strconv.Atoi(bounds[1])
+		if err != nil {
+			return 0, 0, false, true, fmt.Errorf("Invalid range option: %v", v)
+		}
+
+		return low, high, false, true, nil
+	}
+
+	return 0, 0, false, false, nil
+}
+
+// withoutRange returns a copy of desc without range options
+func withoutRange(desc AttributeDescription) AttributeDescription {
+	b := AttributeDescription{Type: desc.Type}
+	for _, v := range desc.Options {
+		if !strings.HasPrefix(strings.ToLower(v), "range=") {
+			b.Options = append(b.Options, v)
+		}
+	}
+
+	return b
+}
+
+// fetchRanges retrieves the remaining values of all ranged attributes of entry and
+// replaces them with attributes holding all values. entry.DN must be the full DN.
+func (c *Manager) fetchRanges(entry *ldap.Entry) error {
+	for _, attr := range entry.Attributes {
+		desc := ParseAttributeDescription(attr.Name)
+
+		_, high, last, ok, err := parseRange(desc)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		base := withoutRange(desc)
+
+		for !last {
+			values, nextHigh, nextLast, err := c.fetchRange(entry.DN, base, high+1)
+			if err != nil {
+				return err
+			}
+
+			// a server not advancing the range would make this loop forever
+			if !nextLast && nextHigh <= high {
+				return fmt.Errorf("Range of %v didn't advance beyond %v.", base, high)
+			}
+
+			attr.Values = append(attr.Values, values...)
+			high, last = nextHigh, nextLast
+		}
+
+		attr.Name = base.String()
+	}
+
+	return nil
+}
+
+// fetchRange retrieves the values of the attribute desc of the entry dn, starting
+// at the value with the index low.
+func (c *Manager) fetchRange(dn string, desc AttributeDescription, low int) (values []string, high int, last bool, err error) {
+	rangeDesc := desc
+	rangeDesc.Options = append(append([]string{}, desc.Options...), fmt.Sprintf("range=%v-*", low))
+
+	searchRequest := ldap.NewSimpleSearchRequest(dn, ldap.ScopeBaseObject, "(objectClass=*)", []string{rangeDesc.String()})
+	searchRequest.Controls = c.requestControls()
+
+	if c.Debug {
+		log.Println("Search request:", searchRequest)
+	}
+
+	results, err := c.doSearch(searchRequest)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if len(results.Entries) != 1 {
+		return nil, 0, false, errors.New("Entry vanished while retrieving ranged attribute values.")
+	}
+
+	return nextRange(results.Entries[0], desc)
+}
+
+// nextRange returns the values of the attribute desc in entry, the response to a range
+// request, and the range they cover.
+func nextRange(entry *ldap.Entry, desc AttributeDescription) (values []string, high int, last bool, err error) {
+	key := desc.key()
+	for _, v := range entry.Attributes {
+		d := ParseAttributeDescription(v.Name)
+		if withoutRange(d).key() != key {
+			continue
+		}
+
+		_, high, last, ok, err := parseRange(d)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		// without a range option the server returned all remaining values
+		if !ok {
+			last = true
+		}
+
+		return v.Values, high, last, nil
+	}
+
+	// the server returned no further range, so there are no more values
+	return nil, 0, true, nil
+}
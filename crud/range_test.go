@@ -0,0 +1,87 @@
+package crud
+
+import (
+	"fmt"
+	"github.com/rbns/ldap"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	low, high, last, ok, err := parseRange(ParseAttributeDescription("member;Range=0-1499"))
+	if err != nil || !ok || last || low != 0 || high != 1499 {
+		t.Error("unexpected range:", low, high, last, ok, err)
+	}
+
+	low, _, last, ok, err = parseRange(ParseAttributeDescription("member;range=1500-*"))
+	if err != nil || !ok || !last || low != 1500 {
+		t.Error("unexpected last range:", low, last, ok, err)
+	}
+
+	_, _, _, ok, err = parseRange(ParseAttributeDescription("member"))
+	if err != nil || ok {
+		t.Error("range found in attribute without range option")
+	}
+
+	_, _, _, _, err = parseRange(ParseAttributeDescription("member;range=foo"))
+	if err == nil {
+		t.Error("invalid range option was accepted")
+	}
+
+	if withoutRange(ParseAttributeDescription("member;range=0-1499;lang-de")).String() != "member;lang-de" {
+		t.Error("range option wasn't removed")
+	}
+}
+
+func TestNextRange(t *testing.T) {
+	member := ParseAttributeDescription("member")
+
+	entry := ldap.NewEntry("cn=staff")
+	entry.AddAttributeValues("member;range=1500-2999", []string{"uid=1500", "uid=1501"})
+	values, high, last, err := nextRange(entry, member)
+	if err != nil || last || high != 2999 || len(values) != 2 {
+		t.Error("unexpected range:", values, high, last, err)
+	}
+
+	// a server may return the remaining values without a range option
+	entry = ldap.NewEntry("cn=staff")
+	entry.AddAttributeValue("member", "uid=3000")
+	values, _, last, err = nextRange(entry, member)
+	if err != nil || !last || len(values) != 1 {
+		t.Error("attribute without range option wasn't the last range:", values, last, err)
+	}
+
+	entry = ldap.NewEntry("cn=staff")
+	_, _, last, err = nextRange(entry, member)
+	if err != nil || !last {
+		t.Error("missing attribute wasn't the last range:", last, err)
+	}
+}
+
+func TestNewModifyRequestHugeAttribute(t *testing.T) {
+	c := New(nil, "dc=example,dc=com")
+
+	oldItem := NewDynamic("cn=staff")
+	newItem := NewDynamic("cn=staff")
+	for i := 0; i < c.MaxReplaceValues+1; i++ {
+		oldItem.Add("member", fmt.Sprintf("uid=%v", i))
+		newItem.Add("member", fmt.Sprintf("uid=%v", i+1))
+	}
+
+	modifyRequest, err := c.newModifyRequest(oldItem, newItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(modifyRequest.Mods) != 2 {
+		t.Fatal("Expected exactly two modifications, got", modifyRequest.Mods)
+	}
+
+	if modifyRequest.Mods[0].ModOperation != ldap.ModDelete || !equalStringSlice(modifyRequest.Mods[0].Modification.Values, []string{"uid=0"}) {
+		t.Error("unexpected first modification:", modifyRequest.Mods[0])
+	}
+
+	added := []string{fmt.Sprintf("uid=%v", c.MaxReplaceValues+1)}
+	if modifyRequest.Mods[1].ModOperation != ldap.ModAdd || !equalStringSlice(modifyRequest.Mods[1].Modification.Values, added) {
+		t.Error("unexpected second modification:", modifyRequest.Mods[1])
+	}
+}
@@ -0,0 +1,168 @@
+package crud
+
+import (
+	"errors"
+	"github.com/rbns/ldap"
+)
+
+// OIDs of the read entry controls (RFC 4527)
+const (
+	oidPreRead  = "1.3.6.1.1.13.1"
+	oidPostRead = "1.3.6.1.1.13.2"
+)
+
+// BER tag of a SearchResultEntry, [APPLICATION 4]
+const berSearchResultEntry = 0x64
+
+// readEntry describes an Item to fill with the entry returned in a read entry control
+type readEntry struct {
+	item  Item
+	attrs []string
+}
+
+// WithPreRead returns a Manager filling item with the state of the entry before each Update
+// and Delete, using the pre-read control (RFC 4527). The entry is read atomically with the
+// modification, so unlike a separate Read it can't be stale.
+//
+// attrs are the attributes to return. If none are given, all user attributes are returned;
+// operational attributes can be requested with "+". If Update finds nothing to change, no
+// request is sent and item is left untouched. DeleteSubtree fills item with the root of
+// the subtree.
+//
+// The returned Manager shares the connection of c.
+func (c *Manager) WithPreRead(item Item, attrs ...string) *Manager {
+	d := c.derive()
+	d.preRead = &readEntry{item: item, attrs: attrs}
+	return d
+}
+
+// WithPostRead returns a Manager filling item with the state of the entry after each Create
+// and Update, using the post-read control (RFC 4527). This returns values populated by the
+// server, like entryUUID or createTimestamp (requested with "+"), in the same round trip.
+// item may be the Item which is created or updated itself.
+//
+// attrs are handled like with WithPreRead. The returned Manager shares the connection of c.
+func (c *Manager) WithPostRead(item Item, attrs ...string) *Manager {
+	d := c.derive()
+	d.postRead = &readEntry{item: item, attrs: attrs}
+	return d
+}
+
+// control returns the read entry control with oid for r
+func (r *readEntry) control(oid string) ldap.Control {
+	attrs := make([][]byte, len(r.attrs))
+	for i, v := range r.attrs {
+		attrs[i] = berEncodeString(berOctetString, v)
+	}
+
+	// AttributeSelection ::= SEQUENCE OF selector LDAPString
+	return ldap.NewControlString(oid, true, string(berEncodeSequence(berSequence, attrs...)))
+}
+
+// readEntryControls returns the read entry controls to send with an operation. pre and
+// post tell if the operation supports the pre-read and the post-read control.
+func (c *Manager) readEntryControls(pre, post bool) []ldap.Control {
+	var controls []ldap.Control
+	if pre && c.preRead != nil {
+		controls = append(controls, c.preRead.control(oidPreRead))
+	}
+	if post && c.postRead != nil {
+		controls = append(controls, c.postRead.control(oidPostRead))
+	}
+
+	return controls
+}
+
+// readEntries fills the items of the read entry controls with the entries returned in the
+// response controls
+func (c *Manager) readEntries(controls []ldap.Control) error {
+	for _, v := range []struct {
+		oid string
+		r   *readEntry
+	}{{oidPreRead, c.preRead}, {oidPostRead, c.postRead}} {
+		if v.r == nil {
+			continue
+		}
+
+		value, ok := findControl(controls, v.oid)
+		if !ok {
+			continue
+		}
+
+		entry, err := parseSearchResultEntry(value)
+		if err != nil {
+			return err
+		}
+
+		entry.DN = c.removeBaseDn(entry.DN)
+
+		err = unmarshal(v.r.item, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseSearchResultEntry decodes a BER encoded SearchResultEntry
+func parseSearchResultEntry(value string) (*ldap.Entry, error) {
+	// SearchResultEntry ::= [APPLICATION 4] SEQUENCE {
+	//      objectName      LDAPDN,
+	//      attributes      PartialAttributeList }
+	//
+	// PartialAttributeList ::= SEQUENCE OF partialAttribute SEQUENCE {
+	//      type       AttributeDescription,
+	//      vals       SET OF value AttributeValue }
+	invalid := errors.New("Invalid SearchResultEntry.")
+
+	e, err := berDecodeSingle([]byte(value))
+	if err != nil {
+		return nil, err
+	}
+
+	if e.tag != berSearchResultEntry {
+		return nil, invalid
+	}
+
+	fields, err := e.children()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) != 2 || fields[0].tag != berOctetString || fields[1].tag != berSequence {
+		return nil, invalid
+	}
+
+	entry := ldap.NewEntry(fields[0].string())
+
+	attributes, err := fields[1].children()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range attributes {
+		attribute, err := v.children()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(attribute) != 2 || attribute[0].tag != berOctetString || attribute[1].tag != berSet {
+			return nil, invalid
+		}
+
+		valueElements, err := attribute[1].children()
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]string, len(valueElements))
+		for i, w := range valueElements {
+			values[i] = w.string()
+		}
+
+		entry.AddAttributeValues(attribute[0].string(), values)
+	}
+
+	return entry, nil
+}
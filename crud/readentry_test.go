@@ -0,0 +1,64 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"testing"
+)
+
+// encodes a SearchResultEntry like a server in a read entry control
+func encodeSearchResultEntry(dn string, attrs map[string][]string) string {
+	var attributes [][]byte
+	for k, v := range attrs {
+		var values [][]byte
+		for _, w := range v {
+			values = append(values, berEncodeString(berOctetString, w))
+		}
+
+		attributes = append(attributes, berEncodeSequence(berSequence,
+			berEncodeString(berOctetString, k),
+			berEncodeSequence(berSet, values...)))
+	}
+
+	return string(berEncodeSequence(berSearchResultEntry,
+		berEncodeString(berOctetString, dn),
+		berEncodeSequence(berSequence, attributes...)))
+}
+
+func TestReadEntries(t *testing.T) {
+	pre := NewDynamic("")
+	post := NewDynamic("")
+	c := New(nil, "dc=example,dc=com").WithPreRead(pre).WithPostRead(post, "*", "+")
+
+	controls := c.readEntryControls(true, false)
+	if len(controls) != 1 || controls[0].GetControlType() != oidPreRead {
+		t.Error("unexpected read entry controls:", controls)
+	}
+
+	value, _ := findControl(c.readEntryControls(false, true), oidPostRead)
+	if value != "\x30\x06\x04\x01*\x04\x01+" {
+		t.Errorf("unexpected post-read control value: % x", value)
+	}
+
+	err := c.readEntries([]ldap.Control{
+		ldap.NewControlString(oidPreRead, false, encodeSearchResultEntry("sn=Foobar,dc=example,dc=com",
+			map[string][]string{"cn": []string{"Fritz"}})),
+		ldap.NewControlString(oidPostRead, false, encodeSearchResultEntry("sn=Foobar,dc=example,dc=com",
+			map[string][]string{"cn": []string{"Gonzo", "von"}})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pre.Dn() != "sn=Foobar" || !equalStringSlice(pre.Get("cn"), []string{"Fritz"}) {
+		t.Error("unexpected pre-read entry:", pre)
+	}
+
+	if post.Dn() != "sn=Foobar" || !equalStringSlice(post.Get("cn"), []string{"Gonzo", "von"}) {
+		t.Error("unexpected post-read entry:", post)
+	}
+
+	_, err = parseSearchResultEntry("\x30\x00")
+	if err == nil {
+		t.Error("invalid SearchResultEntry was parsed")
+	}
+}
@@ -0,0 +1,133 @@
+package crud
+
+import (
+	"fmt"
+	"github.com/rbns/ldap"
+	"strings"
+)
+
+// A Registry maps objectClass values to Item prototypes. It is used to load entries of
+// different kinds with a single search, each entry being returned as the concrete type
+// registered for one of its object classes.
+type Registry struct {
+	// Fallback is used for entries which match none of the registered object classes.
+	// If it is nil, those entries are skipped.
+	Fallback Item
+
+	// registered prototypes in the order of registration
+	prototypes []prototype
+}
+
+// a prototype registered for an object class
+type prototype struct {
+	objectClass string
+	item        Item
+}
+
+// NewRegistry creates an empty Registry without a fallback.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds item as prototype for entries having one of objectClasses. If no object
+// classes are given, the FilterObjectClass of item is used.
+//
+// Entries are matched against the registered object classes in the order of registration,
+// so the more specific classes (e.g. inetOrgPerson) must be registered before the more
+// general ones (e.g. person).
+func (r *Registry) Register(item Item, objectClasses ...string) {
+	if len(objectClasses) == 0 {
+		objectClasses = []string{item.FilterObjectClass()}
+	}
+
+	for _, v := range objectClasses {
+		r.prototypes = append(r.prototypes, prototype{objectClass: strings.ToLower(v), item: item})
+	}
+}
+
+// Lookup returns a copy of the prototype matching the object classes of entry. If none matches,
+// a copy of the Fallback is returned, or nil if the Fallback isn't set.
+func (r *Registry) Lookup(entry *ldap.Entry) Item {
+	objectClasses := make(map[string]bool)
+	for _, v := range entry.GetAttributeValues("objectClass") {
+		objectClasses[strings.ToLower(v)] = true
+	}
+
+	for _, v := range r.prototypes {
+		if objectClasses[v.objectClass] {
+			return v.item.Copy()
+		}
+	}
+
+	if r.Fallback != nil {
+		return r.Fallback.Copy()
+	}
+
+	return nil
+}
+
+// Filter returns a filter matching entries of all registered object classes. If a Fallback
+// is set, the filter matches all entries.
+func (r *Registry) Filter() string {
+	if r.Fallback != nil || len(r.prototypes) == 0 {
+		return "(objectClass=*)"
+	}
+
+	if len(r.prototypes) == 1 {
+		return fmt.Sprintf("(objectClass=%v)", ldap.FilterReplace(r.prototypes[0].objectClass))
+	}
+
+	filter := "(|"
+	for _, v := range r.prototypes {
+		filter += fmt.Sprintf("(objectClass=%v)", ldap.FilterReplace(v.objectClass))
+	}
+
+	return filter + ")"
+}
+
+// unmarshal creates an Item for entry using the registry. If the registry has no matching
+// prototype, nil is returned.
+func (r *Registry) unmarshal(entry *ldap.Entry) (Item, error) {
+	item := r.Lookup(entry)
+	if item == nil {
+		return nil, nil
+	}
+
+	err := unmarshal(item, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ReadAllRegistry works like ReadAll, but instead of copying a single prototype, each
+// found entry is unmarshalled into the Item registered for its object classes in r.
+// Entries without a matching prototype are skipped if r has no Fallback.
+func (c *Manager) ReadAllRegistry(r *Registry, dn string, scope Scope, filter string, args ...interface{}) ([]Item, error) {
+	entries, err := c.search(nil, dn, scope, filter, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(entries))
+	for _, v := range entries {
+		item, err := r.unmarshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// ReadAllRegistrySubtree returns all entries below and including dn which are of one
+// of the kinds registered in r.
+func (c *Manager) ReadAllRegistrySubtree(r *Registry, dn string) ([]Item, error) {
+	// the filter is used as format string, so a '%' in it must be escaped
+	return c.ReadAllRegistry(r, dn, ScopeWholeSubtree, strings.Replace(r.Filter(), "%", "%%", -1))
+}
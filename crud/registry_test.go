@@ -0,0 +1,156 @@
+package crud
+
+import (
+	"errors"
+	"github.com/bytemine/ldap-crud/slapd"
+	"github.com/rbns/ldap"
+	"testing"
+)
+
+// Organizational unit, used to test loading entries of mixed kinds
+type OrganizationalUnit struct {
+	dn string
+	ou []string
+}
+
+func (o *OrganizationalUnit) Copy() Item {
+	return &OrganizationalUnit{dn: o.dn, ou: o.ou}
+}
+
+func (o *OrganizationalUnit) Dn() string {
+	return o.dn
+}
+
+func (o *OrganizationalUnit) FilterObjectClass() string {
+	return "organizationalUnit"
+}
+
+func (o *OrganizationalUnit) MarshalLDAP() (*ldap.Entry, error) {
+	if len(o.ou) < 1 {
+		return nil, errors.New("ou is a must attribute")
+	}
+
+	entry := ldap.NewEntry("")
+	entry.AddAttributeValue("objectClass", "organizationalUnit")
+	entry.AddAttributeValues("ou", o.ou)
+
+	return entry, nil
+}
+
+func (o *OrganizationalUnit) UnmarshalLDAP(entry *ldap.Entry) error {
+	o.dn = entry.DN
+	o.ou = entry.GetAttributeValues("ou")
+	if len(o.ou) < 1 {
+		return errors.New("ou is a must attribute")
+	}
+
+	return nil
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&Person{})
+	r.Register(&OrganizationalUnit{})
+
+	person := ldap.NewEntry("sn=Foobar")
+	person.AddAttributeValues("objectClass", []string{"top", "Person"})
+
+	if _, ok := r.Lookup(person).(*Person); !ok {
+		t.Error("person entry wasn't looked up as *Person")
+	}
+
+	ou := ldap.NewEntry("ou=people")
+	ou.AddAttributeValue("objectClass", "organizationalUnit")
+
+	if _, ok := r.Lookup(ou).(*OrganizationalUnit); !ok {
+		t.Error("organizationalUnit entry wasn't looked up as *OrganizationalUnit")
+	}
+
+	device := ldap.NewEntry("cn=printer")
+	device.AddAttributeValue("objectClass", "device")
+
+	if r.Lookup(device) != nil {
+		t.Error("unknown entry was looked up without a fallback")
+	}
+
+	r.Fallback = &OrganizationalUnit{}
+	if _, ok := r.Lookup(device).(*OrganizationalUnit); !ok {
+		t.Error("unknown entry wasn't looked up as fallback")
+	}
+}
+
+func TestRegistryFilter(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&Person{})
+
+	if r.Filter() != "(objectClass=person)" {
+		t.Error("unexpected filter:", r.Filter())
+	}
+
+	r.Register(&OrganizationalUnit{})
+
+	if r.Filter() != "(|(objectClass=person)(objectClass=organizationalunit))" {
+		t.Error("unexpected filter:", r.Filter())
+	}
+}
+
+func TestReadAllRegistrySubtreeFilter(t *testing.T) {
+	r := NewRegistry()
+	d := NewDynamic("")
+	d.Set("objectClass", "100%Object")
+	r.Register(d)
+
+	var filter string
+	c := New(nil, "").WithInterceptors(func(inv *Invocation, next Handler) error {
+		filter = inv.Request.(*ldap.SearchRequest).Filter
+		return nil
+	})
+
+	_, err := c.ReadAllRegistrySubtree(r, "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if filter != r.Filter() {
+		t.Error("unexpected filter:", filter)
+	}
+}
+
+func TestReadAllRegistrySubtree(t *testing.T) {
+	c, stop := startSlapd(t, &slapd.DefaultConfig)
+	defer stop()
+
+	people := OrganizationalUnit{dn: "ou=people", ou: []string{"people"}}
+	err := c.Create(&people)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fritz := Person{dn: "sn=Foobar,ou=people", sn: []string{"Foobar"}, cn: []string{"Fritz"}}
+	err = c.Create(&fritz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	r.Register(&Person{})
+	r.Register(&OrganizationalUnit{})
+
+	items, err := c.ReadAllRegistrySubtree(r, "ou=people")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 {
+		t.Error("Expected exactly two results, got", len(items))
+	}
+
+	for _, v := range items {
+		t.Log(v.Dn(), v)
+		switch v.(type) {
+		case *Person, *OrganizationalUnit:
+		default:
+			t.Errorf("unexpected type %T", v)
+		}
+	}
+}
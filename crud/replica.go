@@ -0,0 +1,426 @@
+package crud
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/rbns/ldap"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOutsideReplica is returned if a Replica is asked for entries it doesn't hold.
+var ErrOutsideReplica = errors.New("Search base outside of the replica.")
+
+// A Replica holds a local copy of the entries below a DN, kept current with Watch, and
+// answers Read and ReadAll from it. It only holds the entries matching its own filter,
+// so searches for other entries return incomplete results. Filters are evaluated
+// locally, comparing values case-insensitively, and equality filters on indexed
+// attributes are answered from the index.
+//
+// The Replica needs a Manager with a connection of its own and a server supporting
+// content synchronization (syncrepl).
+type Replica struct {
+	// File the entries and the sync cookie are saved to, so a restarted Replica only
+	// fetches the changes since. Optional, must be set before Run.
+	StateFile string
+
+	// Minimum time between two saves of the state file
+	SaveInterval time.Duration
+
+	manager *Manager
+	dn      string
+	scope   Scope
+	filter  string
+
+	mutex   sync.RWMutex
+	entries map[string]*ldap.Entry
+
+	// equality indexes by attribute type, normalized value and normalized dn
+	indexes map[string]map[string]map[string]bool
+
+	state    WatchState
+	ready    chan struct{}
+	closed   bool
+	lastSave time.Time
+}
+
+// NewReplica creates a Replica of the entries below dn matching filter, used like with
+// ReadAll. Equality indexes are kept for the attributes in indexes.
+func NewReplica(m *Manager, dn string, scope Scope, filter string, indexes ...string) *Replica {
+	r := &Replica{
+		SaveInterval: 10 * time.Second,
+		manager:      m,
+		dn:           dn,
+		scope:        scope,
+		filter:       filter,
+		entries:      make(map[string]*ldap.Entry),
+		indexes:      make(map[string]map[string]map[string]bool),
+		ready:        make(chan struct{}),
+	}
+
+	for _, v := range indexes {
+		r.indexes[strings.ToLower(v)] = make(map[string]map[string]bool)
+	}
+
+	return r
+}
+
+// Run loads the state file, if there is one, and keeps the Replica current until
+// Close is called or an error occurs. If the server doesn't accept the saved cookie
+// anymore, the state file has to be removed.
+func (r *Replica) Run() error {
+	if !r.manager.supportsControl(oidSyncRequest) {
+		return ErrUnsupported
+	}
+
+	err := r.load()
+	if err != nil {
+		return err
+	}
+
+	err = r.manager.Watch(NewDynamic(""), &r.state, r.handle, r.dn, r.scope, "%s", r.filter)
+
+	r.mutex.Lock()
+	closed := r.closed
+	r.mutex.Unlock()
+
+	// closing the connection ends the watch with an error
+	if closed {
+		err = nil
+	}
+
+	if r.StateFile != "" {
+		saveErr := r.save()
+		if err == nil {
+			err = saveErr
+		}
+	}
+
+	return err
+}
+
+// Ready returns a channel which is closed when the Replica holds all entries.
+func (r *Replica) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// Close stops the Replica by closing the connection of its Manager.
+func (r *Replica) Close() error {
+	r.mutex.Lock()
+	r.closed = true
+	r.mutex.Unlock()
+
+	return r.manager.Close()
+}
+
+// Read reads the entry of item from the Replica.
+func (r *Replica) Read(item Item) error {
+	r.mutex.RLock()
+	entry, ok := r.entries[normalizeDn(item.Dn())]
+	r.mutex.RUnlock()
+
+	if !ok {
+		return ErrNoSuchObject
+	}
+
+	return unmarshal(item, copyEntry(entry))
+}
+
+// ReadAll searches the Replica like Manager.ReadAll searches the server. The results
+// are sorted by DN.
+func (r *Replica) ReadAll(item Item, dn string, scope Scope, filter string, args ...interface{}) ([]Item, error) {
+	if !inScope(normalizeDn(dn), normalizeDn(r.dn), ScopeWholeSubtree) {
+		return nil, ErrOutsideReplica
+	}
+
+	f, err := parseFilter(formatFilter(filter, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	base := normalizeDn(dn)
+
+	r.mutex.RLock()
+	var entries []*ldap.Entry
+	candidates, indexed := r.candidates(f)
+	for k, v := range r.entries {
+		if indexed && !candidates[k] {
+			continue
+		}
+
+		if inScope(k, base, scope) && f.match(v) {
+			entries = append(entries, copyEntry(v))
+		}
+	}
+	r.mutex.RUnlock()
+
+	sort.Sort(entriesByDn(entries))
+
+	items := make([]Item, len(entries))
+	for i, v := range entries {
+		items[i] = item.Copy()
+		err = unmarshal(items[i], v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+// candidates returns the normalized DNs of the entries possibly matching f according
+// to the indexes. If the indexes can't be used for f, false is returned.
+func (r *Replica) candidates(f filter) (map[string]bool, bool) {
+	switch f := f.(type) {
+	case filterEquality:
+		index, ok := r.indexes[strings.ToLower(f.attr.Type)]
+		if !ok || len(f.attr.Options) > 0 {
+			return nil, false
+		}
+
+		return index[strings.ToLower(f.value)], true
+	case filterAnd:
+		for _, v := range f {
+			if candidates, ok := r.candidates(v); ok {
+				return candidates, true
+			}
+		}
+	case filterOr:
+		union := make(map[string]bool)
+		for _, v := range f {
+			candidates, ok := r.candidates(v)
+			if !ok {
+				return nil, false
+			}
+
+			for k := range candidates {
+				union[k] = true
+			}
+		}
+
+		return union, true
+	}
+
+	return nil, false
+}
+
+// handle applies an event of the watch
+func (r *Replica) handle(e Event) error {
+	r.mutex.Lock()
+	switch e.Type {
+	case EventAdd, EventModify, EventRename:
+		if e.Type == EventRename {
+			r.remove(e.OldDn)
+		}
+
+		entry, err := e.Item.MarshalLDAP()
+		if err != nil {
+			r.mutex.Unlock()
+			return err
+		}
+
+		entry.DN = e.Dn
+		r.remove(e.Dn)
+		r.put(entry)
+	case EventDelete:
+		r.remove(e.Dn)
+	}
+	r.mutex.Unlock()
+
+	if e.Type == EventRefreshDone {
+		select {
+		case <-r.ready:
+		default:
+			close(r.ready)
+		}
+	}
+
+	if r.StateFile != "" && (e.Type == EventRefreshDone || time.Since(r.lastSave) >= r.SaveInterval) {
+		return r.save()
+	}
+
+	return nil
+}
+
+// put adds entry to the entries and indexes, the mutex must be held
+func (r *Replica) put(entry *ldap.Entry) {
+	dn := normalizeDn(entry.DN)
+	r.entries[dn] = entry
+
+	for attr, index := range r.indexes {
+		for _, v := range filterValues(entry, AttributeDescription{Type: attr}) {
+			value := strings.ToLower(v)
+			if index[value] == nil {
+				index[value] = make(map[string]bool)
+			}
+
+			index[value][dn] = true
+		}
+	}
+}
+
+// remove removes the entry with dn from the entries and indexes, the mutex must be held
+func (r *Replica) remove(dn string) {
+	dn = normalizeDn(dn)
+	entry, ok := r.entries[dn]
+	if !ok {
+		return
+	}
+
+	for attr, index := range r.indexes {
+		for _, v := range filterValues(entry, AttributeDescription{Type: attr}) {
+			value := strings.ToLower(v)
+			delete(index[value], dn)
+			if len(index[value]) == 0 {
+				delete(index, value)
+			}
+		}
+	}
+
+	delete(r.entries, dn)
+}
+
+// replicaState is the content of the state file
+type replicaState struct {
+	Cookie  string
+	UUIDs   map[string]string
+	Entries []replicaEntry
+}
+
+// replicaEntry is an entry in the state file, values are []byte to keep binary
+// values intact
+type replicaEntry struct {
+	Dn         string
+	Attributes []replicaAttribute
+}
+
+type replicaAttribute struct {
+	Name   string
+	Values [][]byte
+}
+
+// save writes the state file, replacing the old one only if writing succeeded
+func (r *Replica) save() error {
+	r.mutex.RLock()
+	state := replicaState{Cookie: r.state.Cookie, UUIDs: r.state.Entries}
+	for _, e := range r.entries {
+		entry := replicaEntry{Dn: e.DN}
+		for _, a := range e.Attributes {
+			attr := replicaAttribute{Name: a.Name, Values: make([][]byte, len(a.Values))}
+			for i, v := range a.Values {
+				attr.Values[i] = []byte(v)
+			}
+
+			entry.Attributes = append(entry.Attributes, attr)
+		}
+
+		state.Entries = append(state.Entries, entry)
+	}
+	data, err := json.Marshal(state)
+	r.mutex.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	r.lastSave = time.Now()
+
+	tmp := r.StateFile + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.StateFile)
+}
+
+// load reads the state file if it exists
+func (r *Replica) load() error {
+	if r.StateFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(r.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var state replicaState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.state = WatchState{Cookie: state.Cookie, Entries: state.UUIDs}
+	for _, e := range state.Entries {
+		entry := ldap.NewEntry(e.Dn)
+		for _, a := range e.Attributes {
+			values := make([]string, len(a.Values))
+			for i, v := range a.Values {
+				values[i] = string(v)
+			}
+
+			entry.AddAttributeValues(a.Name, values)
+		}
+
+		r.put(entry)
+	}
+
+	return nil
+}
+
+// normalizeDn normalizes dn for comparisons
+func normalizeDn(dn string) string {
+	rdns := strings.Split(strings.ToLower(dn), ",")
+	for i, v := range rdns {
+		rdns[i] = strings.TrimSpace(v)
+	}
+
+	return strings.Join(rdns, ",")
+}
+
+// inScope reports if the normalized dn is within scope of the normalized base
+func inScope(dn, base string, scope Scope) bool {
+	switch scope {
+	case ScopeBaseObject:
+		return dn == base
+	case ScopeSingleLevel:
+		return dn != "" && parentDn(dn) == base
+	}
+
+	return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+// copyEntry returns a deep copy of e
+func copyEntry(e *ldap.Entry) *ldap.Entry {
+	entry := ldap.NewEntry(e.DN)
+	for _, v := range e.Attributes {
+		entry.AddAttributeValues(v.Name, append([]string(nil), v.Values...))
+	}
+
+	return entry
+}
+
+// entriesByDn sorts entries by their normalized DN
+type entriesByDn []*ldap.Entry
+
+func (e entriesByDn) Len() int {
+	return len(e)
+}
+
+func (e entriesByDn) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+}
+
+func (e entriesByDn) Less(i, j int) bool {
+	return normalizeDn(e[i].DN) < normalizeDn(e[j].DN)
+}
@@ -0,0 +1,124 @@
+package crud
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// replicaEvent returns an event for an organizationalUnit with the given description
+func replicaEvent(typ EventType, dn, description string) Event {
+	d := NewDynamic(dn)
+	d.Set("objectClass", "organizationalUnit")
+	d.Set("ou", dn[3:])
+	d.Set("description", description)
+	return Event{Type: typ, Dn: dn, Item: d}
+}
+
+func TestReplica(t *testing.T) {
+	r := NewReplica(New(nil, "dc=example,dc=com"), "", ScopeWholeSubtree, "(objectClass=*)", "description")
+
+	events := []Event{
+		replicaEvent(EventAdd, "ou=a", "x"),
+		replicaEvent(EventAdd, "ou=b", "y"),
+		replicaEvent(EventAdd, "ou=c,ou=a", "x"),
+		replicaEvent(EventModify, "ou=b", "x"),
+		{Type: EventRefreshDone},
+		replicaEvent(EventRename, "ou=d", "y"),
+		{Type: EventDelete, Dn: "ou=C,ou=A"},
+	}
+	events[5].OldDn = "ou=a"
+
+	for _, v := range events {
+		err := r.handle(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-r.Ready():
+	default:
+		t.Error("Replica not ready after refresh")
+	}
+
+	d := NewDynamic("OU=B")
+	err := r.Read(d)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if d.GetValue("description") != "x" {
+		t.Error("unexpected entry:", d)
+	}
+
+	err = r.Read(NewDynamic("ou=a"))
+	if err != ErrNoSuchObject {
+		t.Error("expected ErrNoSuchObject for renamed entry, got", err)
+	}
+
+	items, err := r.ReadAll(NewDynamic(""), "", ScopeWholeSubtree, "(description=%v)", "Y")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 1 || items[0].Dn() != "ou=d" {
+		t.Error("unexpected results:", items)
+	}
+
+	// the old values of modified entries must be gone from the index
+	items, err = r.ReadAll(NewDynamic(""), "", ScopeSingleLevel, "(|(description=x)(description=y))")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 2 || items[0].Dn() != "ou=b" || items[1].Dn() != "ou=d" {
+		t.Error("unexpected results:", items)
+	}
+}
+
+func TestReplicaState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewReplica(New(nil, ""), "", ScopeWholeSubtree, "(objectClass=*)")
+	r.StateFile = filepath.Join(dir, "state")
+	r.state.Cookie = "cookie"
+
+	photo := replicaEvent(EventAdd, "ou=a", "x")
+	photo.Item.(*Dynamic).SetBinary("jpegPhoto", []byte{0xff, 0xd8, 0x00})
+
+	err = r.handle(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewReplica(New(nil, ""), "", ScopeWholeSubtree, "(objectClass=*)", "ou")
+	s.StateFile = r.StateFile
+	err = s.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.state.Cookie != "cookie" {
+		t.Error("unexpected cookie:", s.state.Cookie)
+	}
+
+	items, err := s.ReadAll(NewDynamic(""), "", ScopeWholeSubtree, "(ou=a)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || string(items[0].(*Dynamic).GetBinary("jpegPhoto")[0]) != "\xff\xd8\x00" {
+		t.Error("unexpected results:", items)
+	}
+}
@@ -0,0 +1,119 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+)
+
+// The methods in this file send the requests built by the Manager to the server.
+// All operations go through them, so everything which applies to every request and
+// response, like collecting response controls or writing changes in dry run mode,
+// is done here.
+
+// doAdd sends an add request
+func (c *Manager) doAdd(addRequest *ldap.AddRequest) error {
+	if c.dryRun != nil {
+		return c.writeAdd(addRequest)
+	}
+
+	addRequest.Controls = append(addRequest.Controls, c.readEntryControls(false, true)...)
+
+	result, err := c.conn.AddWithResult(addRequest)
+	if result != nil {
+		c.setResponseControls(result.Controls)
+	}
+
+	if err != nil || result == nil {
+		return err
+	}
+
+	return c.readEntries(result.Controls)
+}
+
+// doModify sends a modify request
+func (c *Manager) doModify(modifyRequest *ldap.ModifyRequest) error {
+	if c.dryRun != nil {
+		return c.writeModify(modifyRequest)
+	}
+
+	modifyRequest.Controls = append(modifyRequest.Controls, c.readEntryControls(true, true)...)
+
+	result, err := c.conn.ModifyWithResult(modifyRequest)
+	if result != nil {
+		c.setResponseControls(result.Controls)
+	}
+
+	if err != nil || result == nil {
+		return err
+	}
+
+	return c.readEntries(result.Controls)
+}
+
+// doDelete sends a delete request
+func (c *Manager) doDelete(deleteRequest *ldap.DeleteRequest) error {
+	if c.dryRun != nil {
+		return c.writeDelete(deleteRequest)
+	}
+
+	deleteRequest.Controls = append(deleteRequest.Controls, c.readEntryControls(true, false)...)
+
+	result, err := c.conn.DeleteWithResult(deleteRequest)
+	if result != nil {
+		c.setResponseControls(result.Controls)
+	}
+
+	if err != nil || result == nil {
+		return err
+	}
+
+	return c.readEntries(result.Controls)
+}
+
+// doModifyDN sends a modify DN request
+func (c *Manager) doModifyDN(modifyDNRequest *ldap.ModifyDNRequest) error {
+	if c.dryRun != nil {
+		return c.writeModifyDN(modifyDNRequest)
+	}
+
+	return c.conn.ModifyDN(modifyDNRequest)
+}
+
+// doSearch sends a search request
+func (c *Manager) doSearch(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result, err := c.conn.Search(searchRequest)
+	if result != nil {
+		c.setResponseControls(result.Controls)
+	}
+
+	return result, err
+}
+
+// doSearchWithHandler sends a search request, handler is called for every message
+// received before the search is done
+func (c *Manager) doSearchWithHandler(searchRequest *ldap.SearchRequest, handler func(*ldap.SearchMessage) error) (*ldap.SearchResult, error) {
+	result, err := c.conn.SearchWithHandler(searchRequest, handler)
+	if result != nil {
+		c.setResponseControls(result.Controls)
+	}
+
+	return result, err
+}
+
+// doExtended sends an extended request
+func (c *Manager) doExtended(extendedRequest *ldap.ExtendedRequest) (*ldap.ExtendedResponse, error) {
+	if c.dryRun != nil && extendedRequest.Name == oidPasswdModify {
+		return nil, ErrDryRun
+	}
+
+	response, err := c.conn.Extended(extendedRequest)
+	if response != nil {
+		c.setResponseControls(response.Controls)
+	}
+
+	return response, err
+}
+
+// doCompare sends a compare request
+func (c *Manager) doCompare(compareRequest *ldap.CompareRequest) (bool, error) {
+	return c.conn.Compare(compareRequest)
+}
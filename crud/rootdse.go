@@ -0,0 +1,131 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"log"
+	"strings"
+	"sync"
+)
+
+// RootDSE holds the information the server publishes about itself in the root DSE
+// (RFC 4512 section 5.1).
+type RootDSE struct {
+	NamingContexts          []string
+	SupportedControl        []string
+	SupportedExtension      []string
+	SupportedFeatures       []string
+	SupportedSASLMechanisms []string
+	SupportedLDAPVersion    []string
+	VendorName              string
+	VendorVersion           string
+	SubschemaSubentry       string
+}
+
+// attributes of the root DSE to request, they are operational and not returned by default
+var rootDSEAttributes = []string{"namingContexts", "supportedControl", "supportedExtension",
+	"supportedFeatures", "supportedSASLMechanisms", "supportedLDAPVersion", "vendorName",
+	"vendorVersion", "subschemaSubentry"}
+
+// rootDSECache caches the root DSE for a Manager and all Managers derived from it
+type rootDSECache struct {
+	mutex   sync.Mutex
+	rootDSE *RootDSE
+}
+
+// SupportsControl reports if the server supports the control oid.
+func (r *RootDSE) SupportsControl(oid string) bool {
+	return containsString(r.SupportedControl, oid)
+}
+
+// SupportsExtension reports if the server supports the extended operation oid.
+func (r *RootDSE) SupportsExtension(oid string) bool {
+	return containsString(r.SupportedExtension, oid)
+}
+
+// SupportsFeature reports if the server supports the feature oid.
+func (r *RootDSE) SupportsFeature(oid string) bool {
+	return containsString(r.SupportedFeatures, oid)
+}
+
+// SupportsSASLMechanism reports if the server supports the SASL mechanism name.
+func (r *RootDSE) SupportsSASLMechanism(name string) bool {
+	for _, v := range r.SupportedSASLMechanisms {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RootDSE reads the root DSE of the server. It is read once and cached for the
+// Manager and all Managers derived from it. If reading fails, it is read again
+// the next time.
+func (c *Manager) RootDSE() (*RootDSE, error) {
+	c.rootDSE.mutex.Lock()
+	defer c.rootDSE.mutex.Unlock()
+
+	if c.rootDSE.rootDSE == nil {
+		rootDSE, err := c.readRootDSE()
+		if err != nil {
+			return nil, err
+		}
+
+		c.rootDSE.rootDSE = rootDSE
+	}
+
+	return c.rootDSE.rootDSE, nil
+}
+
+// readRootDSE reads the root DSE from the server
+func (c *Manager) readRootDSE() (*RootDSE, error) {
+	searchRequest := ldap.NewSimpleSearchRequest("", ldap.ScopeBaseObject, "(objectClass=*)", rootDSEAttributes)
+
+	if c.Debug {
+		log.Println("Search request:", searchRequest)
+	}
+
+	results, err := c.doSearch(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results.Entries) != 1 {
+		return nil, ErrNoSuchObject
+	}
+
+	e := results.Entries[0]
+	return &RootDSE{
+		NamingContexts:          e.GetAttributeValues("namingContexts"),
+		SupportedControl:        e.GetAttributeValues("supportedControl"),
+		SupportedExtension:      e.GetAttributeValues("supportedExtension"),
+		SupportedFeatures:       e.GetAttributeValues("supportedFeatures"),
+		SupportedSASLMechanisms: e.GetAttributeValues("supportedSASLMechanisms"),
+		SupportedLDAPVersion:    e.GetAttributeValues("supportedLDAPVersion"),
+		VendorName:              e.GetAttributeValue("vendorName"),
+		VendorVersion:           e.GetAttributeValue("vendorVersion"),
+		SubschemaSubentry:       e.GetAttributeValue("subschemaSubentry"),
+	}, nil
+}
+
+// supportsControl reports if the server supports the control oid. If the root DSE
+// can't be read, e.g. because of ACLs, the control is assumed to be supported.
+func (c *Manager) supportsControl(oid string) bool {
+	rootDSE, err := c.RootDSE()
+	if err != nil {
+		return true
+	}
+
+	return rootDSE.SupportsControl(oid)
+}
+
+// supportsExtension reports if the server supports the extended operation oid. If the
+// root DSE can't be read, the extended operation is assumed to be supported.
+func (c *Manager) supportsExtension(oid string) bool {
+	rootDSE, err := c.RootDSE()
+	if err != nil {
+		return true
+	}
+
+	return rootDSE.SupportsExtension(oid)
+}
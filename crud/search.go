@@ -0,0 +1,242 @@
+package crud
+
+import (
+	"errors"
+	"github.com/rbns/ldap"
+	"sort"
+	"strings"
+)
+
+// OIDs of the search and delete controls used by the Manager
+const (
+	// Paged results control (RFC 2696)
+	oidPagedResults = "1.2.840.113556.1.4.319"
+
+	// Server side sorting request and response controls (RFC 2891)
+	oidServerSideSort       = "1.2.840.113556.1.4.473"
+	oidServerSideSortResult = "1.2.840.113556.1.4.474"
+
+	// Tree delete control (draft-armijo-ldap-treedelete)
+	oidTreeDelete = "1.2.840.113556.1.4.805"
+)
+
+// WithSort returns a Manager which returns the results of ReadAll and its variants
+// sorted by the values of the given attributes. An attribute prefixed with "-" is
+// sorted in reverse order. If the server doesn't support server side sorting, the
+// results are sorted by the Manager by comparing the first values case-insensitively.
+func (c *Manager) WithSort(attrs ...string) *Manager {
+	m := c.derive()
+	m.sortKeys = append([]string(nil), attrs...)
+	return m
+}
+
+// WithOperationalAttributes returns a Manager which requests operational attributes,
+// like entryUUID or modifyTimestamp, in addition to the user attributes when reading.
+func (c *Manager) WithOperationalAttributes() *Manager {
+	m := c.derive()
+	m.operational = true
+	return m
+}
+
+// attributes returns the attributes to request when reading
+func (c *Manager) attributes() []string {
+	if c.operational {
+		return []string{"*", "+"}
+	}
+
+	return nil
+}
+
+// newPagedResultsControl returns a paged results control requesting a page of
+// size entries after cookie.
+func newPagedResultsControl(size int, cookie string) ldap.Control {
+	// realSearchControlValue ::= SEQUENCE { size INTEGER, cookie OCTET STRING }
+	value := berEncodeSequence(berSequence, berEncodeInt(berInteger, int64(size)), berEncodeString(berOctetString, cookie))
+	return ldap.NewControlString(oidPagedResults, false, string(value))
+}
+
+// parsePagedResults returns the cookie of the paged results response control,
+// the empty string marks the last page.
+func parsePagedResults(controls []ldap.Control) (string, error) {
+	value, ok := findControl(controls, oidPagedResults)
+	if !ok || value == "" {
+		return "", nil
+	}
+
+	e, err := berDecodeSingle([]byte(value))
+	if err != nil {
+		return "", err
+	}
+
+	fields, err := e.children()
+	if err != nil {
+		return "", err
+	}
+
+	if len(fields) != 2 {
+		return "", errors.New("Invalid paged results control.")
+	}
+
+	return fields[1].string(), nil
+}
+
+// newSortControl returns a non-critical server side sort control for keys.
+func newSortControl(keys []string) ldap.Control {
+	// SortKeyList ::= SEQUENCE OF SEQUENCE {
+	//     attributeType AttributeDescription,
+	//     orderingRule [0] MatchingRuleId OPTIONAL,
+	//     reverseOrder [1] BOOLEAN DEFAULT FALSE }
+	var list [][]byte
+	for _, v := range keys {
+		attr, reverse := sortKey(v)
+
+		fields := [][]byte{berEncodeString(berOctetString, attr)}
+		if reverse {
+			fields = append(fields, berEncodeBool(berContext|1, true))
+		}
+
+		list = append(list, berEncodeSequence(berSequence, fields...))
+	}
+
+	return ldap.NewControlString(oidServerSideSort, false, string(berEncodeSequence(berSequence, list...)))
+}
+
+// sortSucceeded reports if the server side sort response control reports success.
+func sortSucceeded(controls []ldap.Control) bool {
+	value, ok := findControl(controls, oidServerSideSortResult)
+	if !ok {
+		return false
+	}
+
+	// SortResult ::= SEQUENCE { sortResult ENUMERATED, attributeType [0] OPTIONAL }
+	e, err := berDecodeSingle([]byte(value))
+	if err != nil {
+		return false
+	}
+
+	fields, err := e.children()
+	if err != nil || len(fields) == 0 {
+		return false
+	}
+
+	return fields[0].int() == 0
+}
+
+// sortKey splits a sort key into the attribute and the reverse flag.
+func sortKey(key string) (string, bool) {
+	if strings.HasPrefix(key, "-") {
+		return key[1:], true
+	}
+
+	return key, false
+}
+
+// entrySorter sorts entries by the first values of the attributes in keys. Entries
+// without a value sort after entries with one, as with server side sorting.
+type entrySorter struct {
+	entries []*ldap.Entry
+	keys    []string
+}
+
+func (s entrySorter) Len() int {
+	return len(s.entries)
+}
+
+func (s entrySorter) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+}
+
+func (s entrySorter) Less(i, j int) bool {
+	for _, v := range s.keys {
+		attr, reverse := sortKey(v)
+
+		a, aok := sortValue(s.entries[i], attr)
+		b, bok := sortValue(s.entries[j], attr)
+
+		switch {
+		case aok && !bok:
+			return true
+		case !aok && bok:
+			return false
+		case a == b:
+			continue
+		case reverse:
+			return a > b
+		default:
+			return a < b
+		}
+	}
+
+	return false
+}
+
+// sortValue returns the normalized first value of attr in e.
+func sortValue(e *ldap.Entry, attr string) (string, bool) {
+	key := attributeKey(attr)
+	for _, v := range e.Attributes {
+		if attributeKey(v.Name) == key && len(v.Values) > 0 {
+			return strings.ToLower(v.Values[0]), true
+		}
+	}
+
+	return "", false
+}
+
+// searchEntries sends searchRequest and returns all entries found. If PageSize is
+// set and the server supports it, the entries are retrieved in pages. If sort keys
+// are set, the entries are sorted by the server or, if it can't, locally.
+func (c *Manager) searchEntries(searchRequest *ldap.SearchRequest) ([]*ldap.Entry, error) {
+	controls := searchRequest.Controls
+
+	serverSort := len(c.sortKeys) > 0 && c.supportsControl(oidServerSideSort)
+	if serverSort {
+		controls = append(controls, newSortControl(c.sortKeys))
+	}
+
+	paged := c.PageSize > 0 && c.supportsControl(oidPagedResults)
+
+	var entries []*ldap.Entry
+	sorted := serverSort
+	cookie := ""
+	for {
+		searchRequest.Controls = controls
+		if paged {
+			searchRequest.Controls = append(controls[:len(controls):len(controls)], newPagedResultsControl(c.PageSize, cookie))
+		}
+
+		results, err := c.doSearch(searchRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, results.Entries...)
+
+		if serverSort && !sortSucceeded(results.Controls) {
+			sorted = false
+		}
+
+		if !paged {
+			break
+		}
+
+		cookie, err = parsePagedResults(results.Controls)
+		if err != nil {
+			return nil, err
+		}
+
+		if cookie == "" {
+			break
+		}
+	}
+
+	if len(c.sortKeys) > 0 && !sorted {
+		c.sortEntries(entries)
+	}
+
+	return entries, nil
+}
+
+// sortEntries sorts entries locally by the sort keys of the Manager.
+func (c *Manager) sortEntries(entries []*ldap.Entry) {
+	sort.Stable(entrySorter{entries: entries, keys: c.sortKeys})
+}
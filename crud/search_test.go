@@ -0,0 +1,96 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"testing"
+)
+
+func TestSortControl(t *testing.T) {
+	control := newSortControl([]string{"sn", "-cn"}).(*ldap.ControlString)
+
+	// SEQUENCE { SEQUENCE { "sn" }, SEQUENCE { "cn", [1] TRUE } }
+	expected := "\x30\x0f\x30\x04\x04\x02sn\x30\x07\x04\x02cn\x81\x01\xff"
+	if control.ControlValue != expected {
+		t.Errorf("unexpected sort control value: %x", control.ControlValue)
+	}
+
+	if control.Criticality {
+		t.Error("sort control must not be critical")
+	}
+}
+
+func TestSortSucceeded(t *testing.T) {
+	success := ldap.NewControlString(oidServerSideSortResult, false, "\x30\x03\x0a\x01\x00")
+	if !sortSucceeded([]ldap.Control{success}) {
+		t.Error("expected sort to have succeeded")
+	}
+
+	failure := ldap.NewControlString(oidServerSideSortResult, false, "\x30\x03\x0a\x01\x10")
+	if sortSucceeded([]ldap.Control{failure}) {
+		t.Error("expected sort to have failed")
+	}
+
+	if sortSucceeded(nil) {
+		t.Error("expected sort without response control to have failed")
+	}
+}
+
+func TestPagedResults(t *testing.T) {
+	control := newPagedResultsControl(100, "").(*ldap.ControlString)
+	if control.ControlValue != "\x30\x05\x02\x01\x64\x04\x00" {
+		t.Errorf("unexpected paged results control value: %x", control.ControlValue)
+	}
+
+	response := newPagedResultsControl(0, "cookie")
+	cookie, err := parsePagedResults([]ldap.Control{response})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if cookie != "cookie" {
+		t.Error("unexpected cookie:", cookie)
+	}
+
+	cookie, err = parsePagedResults(nil)
+	if err != nil || cookie != "" {
+		t.Error("expected empty cookie without response control")
+	}
+}
+
+func TestEntrySorter(t *testing.T) {
+	entries := []*ldap.Entry{
+		ldap.NewEntry("cn=b"),
+		ldap.NewEntry("cn=none"),
+		ldap.NewEntry("cn=A"),
+		ldap.NewEntry("cn=c"),
+	}
+	entries[0].AddAttributeValue("cn", "b")
+	entries[2].AddAttributeValue("CN", "A")
+	entries[3].AddAttributeValue("cn", "c")
+
+	c := New(nil, "").WithSort("cn")
+	c.sortEntries(entries)
+	if entries[0].DN != "cn=A" || entries[1].DN != "cn=b" || entries[2].DN != "cn=c" || entries[3].DN != "cn=none" {
+		t.Error("unexpected order:", entries[0].DN, entries[1].DN, entries[2].DN, entries[3].DN)
+	}
+
+	c = New(nil, "").WithSort("-cn")
+	c.sortEntries(entries)
+	if entries[0].DN != "cn=c" || entries[1].DN != "cn=b" || entries[2].DN != "cn=A" || entries[3].DN != "cn=none" {
+		t.Error("unexpected reverse order:", entries[0].DN, entries[1].DN, entries[2].DN, entries[3].DN)
+	}
+}
+
+func TestRootDSESharing(t *testing.T) {
+	c := New(nil, "dc=example,dc=com")
+	c.rootDSE.rootDSE = &RootDSE{SupportedControl: []string{oidPagedResults}}
+
+	d := c.WithSort("cn")
+	if !d.supportsControl(oidPagedResults) {
+		t.Error("derived Manager doesn't share the root DSE")
+	}
+
+	if d.supportsControl(oidTreeDelete) {
+		t.Error("unsupported control reported as supported")
+	}
+}
@@ -0,0 +1,565 @@
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rbns/ldap"
+	"log"
+)
+
+// OIDs of the controls and messages used for watching
+const (
+	// Content synchronization (RFC 4533)
+	oidSyncRequest = "1.3.6.1.4.1.4203.1.9.1.1"
+	oidSyncState   = "1.3.6.1.4.1.4203.1.9.1.2"
+	oidSyncDone    = "1.3.6.1.4.1.4203.1.9.1.3"
+	oidSyncInfo    = "1.3.6.1.4.1.4203.1.9.1.4"
+
+	// Persistent search (draft-ietf-ldapext-psearch)
+	oidPersistentSearch        = "2.16.840.1.113730.3.4.3"
+	oidEntryChangeNotification = "2.16.840.1.113730.3.4.7"
+)
+
+// refreshAndPersist mode of the sync request control
+const syncRefreshAndPersist = 3
+
+// states of the sync state control
+const (
+	syncStatePresent = 0
+	syncStateAdd     = 1
+	syncStateModify  = 2
+	syncStateDelete  = 3
+)
+
+// change types of the persistent search and entry change notification controls
+const (
+	psearchAdd    = 1
+	psearchDelete = 2
+	psearchModify = 4
+	psearchModDN  = 8
+)
+
+// ErrStopWatch can be returned by a WatchHandler to stop watching without an error.
+var ErrStopWatch = errors.New("Stop watching.")
+
+// EventType is the kind of change an Event reports.
+type EventType int
+
+const (
+	// An entry was added or appeared in the watched area
+	EventAdd EventType = iota
+
+	// An entry was modified
+	EventModify
+
+	// An entry was deleted or left the watched area
+	EventDelete
+
+	// An entry was renamed or moved, it may have been modified as well
+	EventRename
+
+	// The initial content has been sent, the following events are changes
+	EventRefreshDone
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdd:
+		return "add"
+	case EventModify:
+		return "modify"
+	case EventDelete:
+		return "delete"
+	case EventRename:
+		return "rename"
+	case EventRefreshDone:
+		return "refresh done"
+	}
+
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a change of a watched entry.
+type Event struct {
+	Type EventType
+
+	// DN of the entry, without the base DN of the Manager
+	Dn string
+
+	// Previous DN of a renamed entry
+	OldDn string
+
+	// entryUUID of the entry, empty with persistent search
+	EntryUUID string
+
+	// The entry unmarshalled into a copy of the watched Item, nil for deletes
+	Item Item
+
+	// Sync cookie to resume watching after this event, empty with persistent search
+	Cookie string
+}
+
+// WatchState holds what is needed to resume a Watch. It is updated before each
+// event is handled, so it can be saved from within the WatchHandler.
+type WatchState struct {
+	// Sync cookie of the last event
+	Cookie string
+
+	// DNs of the watched entries by their entryUUID, needed to report deletes and
+	// renames correctly after resuming
+	Entries map[string]string
+}
+
+// WatchHandler is called for every Event of a Watch. If it returns an error, watching
+// is stopped and Watch returns the error, unless it is ErrStopWatch.
+type WatchHandler func(Event) error
+
+// Watch watches the entries below dn matching filter and calls handler for every change.
+// dn, scope, filter and args are used as with ReadAll, changed entries are unmarshalled
+// into copies of item.
+//
+// Content synchronization (syncrepl) in refreshAndPersist mode is used if the server
+// supports it, resuming from state if it isn't nil. Otherwise a persistent search is
+// used, which can't be resumed and doesn't report EventRefreshDone.
+//
+// Watch blocks until the handler returns an error, the server ends the search or the
+// connection of the Manager is closed, so it should use a Manager of its own.
+func (c *Manager) Watch(item Item, state *WatchState, handler WatchHandler, dn string, scope Scope, filter string, args ...interface{}) error {
+	if state == nil {
+		state = new(WatchState)
+	}
+
+	if state.Entries == nil {
+		state.Entries = make(map[string]string)
+	}
+
+	w := &watch{manager: c, item: item, state: state, handler: handler}
+
+	searchRequest := ldap.NewSimpleSearchRequest(c.appendBaseDn(dn), ldap.Scope(scope), formatFilter(filter, args...), nil)
+
+	var err error
+	switch {
+	case c.supportsControl(oidSyncRequest):
+		searchRequest.Controls = c.requestControls(newSyncRequestControl(syncRefreshAndPersist, state.Cookie))
+		err = w.run(searchRequest, w.handleSync)
+	case c.supportsControl(oidPersistentSearch):
+		searchRequest.Controls = c.requestControls(newPersistentSearchControl())
+		err = w.run(searchRequest, w.handlePersistentSearch)
+	default:
+		return ErrUnsupported
+	}
+
+	if err == ErrStopWatch {
+		return nil
+	}
+
+	return err
+}
+
+// watch is a running Watch
+type watch struct {
+	manager *Manager
+	item    Item
+	state   *WatchState
+	handler WatchHandler
+
+	// entryUUIDs seen during the refresh, for a present phase
+	present map[string]bool
+
+	// true after the refresh is done
+	refreshed bool
+}
+
+// run sends the search request and handles its messages
+func (w *watch) run(searchRequest *ldap.SearchRequest, handle func(*ldap.SearchMessage) error) error {
+	if w.manager.Debug {
+		log.Println("Watch request:", searchRequest)
+	}
+
+	var handlerErr error
+	result, err := w.manager.doSearchWithHandler(searchRequest, func(m *ldap.SearchMessage) error {
+		handlerErr = handle(m)
+		return handlerErr
+	})
+
+	// errors of the handler take precedence, the search was abandoned because of them
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if result != nil {
+		// the server ended the search, its cookie is still useful for resuming
+		if value, ok := findControl(result.Controls, oidSyncDone); ok {
+			cookie, _, err := parseSyncDone(value)
+			if err != nil {
+				return err
+			}
+
+			if cookie != "" {
+				w.state.Cookie = cookie
+			}
+		}
+	}
+
+	return nil
+}
+
+// emit updates the state and calls the handler
+func (w *watch) emit(event Event) error {
+	if event.Cookie != "" {
+		w.state.Cookie = event.Cookie
+	}
+	event.Cookie = w.state.Cookie
+
+	if event.EntryUUID != "" {
+		if event.Type == EventDelete {
+			delete(w.state.Entries, event.EntryUUID)
+		} else {
+			w.state.Entries[event.EntryUUID] = event.Dn
+		}
+	}
+
+	return w.handler(event)
+}
+
+// unmarshal unmarshals e into a copy of the watched item
+func (w *watch) unmarshal(e *ldap.Entry) (Item, error) {
+	err := w.manager.fetchRanges(e)
+	if err != nil {
+		return nil, err
+	}
+
+	e.DN = w.manager.removeBaseDn(e.DN)
+
+	item := w.item.Copy()
+	return item, unmarshal(item, e)
+}
+
+// handleSync handles a message of a content synchronization
+func (w *watch) handleSync(m *ldap.SearchMessage) error {
+	if m.Intermediate != nil {
+		if m.Intermediate.Name != oidSyncInfo {
+			return nil
+		}
+
+		return w.handleSyncInfo(m.Intermediate.Value)
+	}
+
+	if m.Entry == nil {
+		return nil
+	}
+
+	value, ok := findControl(m.Controls, oidSyncState)
+	if !ok {
+		return errors.New("Entry without sync state control.")
+	}
+
+	state, entryUUID, cookie, err := parseSyncState(value)
+	if err != nil {
+		return err
+	}
+
+	if !w.refreshed {
+		w.markPresent(entryUUID)
+	}
+
+	event := Event{Dn: w.manager.removeBaseDn(m.Entry.DN), EntryUUID: entryUUID, Cookie: cookie}
+
+	switch state {
+	case syncStatePresent:
+		if cookie != "" {
+			w.state.Cookie = cookie
+		}
+		return nil
+	case syncStateDelete:
+		event.Type = EventDelete
+		return w.emit(event)
+	case syncStateAdd:
+		event.Type = EventAdd
+	case syncStateModify:
+		event.Type = EventModify
+		if oldDn, ok := w.state.Entries[entryUUID]; ok && normalizeDn(oldDn) != normalizeDn(event.Dn) {
+			event.Type = EventRename
+			event.OldDn = oldDn
+		}
+	default:
+		return fmt.Errorf("Unknown sync state %d.", state)
+	}
+
+	event.Item, err = w.unmarshal(m.Entry)
+	if err != nil {
+		return err
+	}
+
+	return w.emit(event)
+}
+
+// handleSyncInfo handles a sync info message
+func (w *watch) handleSyncInfo(value string) error {
+	// syncInfoValue ::= CHOICE {
+	//     newcookie      [0] syncCookie,
+	//     refreshDelete  [1] SEQUENCE { cookie syncCookie OPTIONAL, refreshDone BOOLEAN DEFAULT TRUE },
+	//     refreshPresent [2] SEQUENCE { cookie syncCookie OPTIONAL, refreshDone BOOLEAN DEFAULT TRUE },
+	//     syncIdSet      [3] SEQUENCE { cookie syncCookie OPTIONAL, refreshDeletes BOOLEAN DEFAULT FALSE,
+	//                                   syncUUIDs SET OF syncUUID } }
+	info, err := berDecodeSingle([]byte(value))
+	if err != nil {
+		return err
+	}
+
+	if info.tag == berContext|0 {
+		w.state.Cookie = info.string()
+		return nil
+	}
+
+	fields, err := info.children()
+	if err != nil {
+		return err
+	}
+
+	var (
+		cookie   string
+		flag     *bool
+		uuidsSet []berElement
+	)
+	for _, v := range fields {
+		switch v.tag {
+		case berOctetString:
+			cookie = v.string()
+		case berBoolean:
+			b := v.bool()
+			flag = &b
+		case berSet:
+			uuidsSet, err = v.children()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if cookie != "" {
+		w.state.Cookie = cookie
+	}
+
+	switch info.tag {
+	case berContext | berConstructed | 1:
+		// refreshDelete: deleted entries have been sent
+		if flag == nil || *flag {
+			return w.refreshDone()
+		}
+	case berContext | berConstructed | 2:
+		// refreshPresent: entries not reported present have been deleted
+		err = w.deleteMissing()
+		if err != nil {
+			return err
+		}
+
+		if flag == nil || *flag {
+			return w.refreshDone()
+		}
+	case berContext | berConstructed | 3:
+		for _, v := range uuidsSet {
+			entryUUID := formatUUID(v.content)
+
+			if flag != nil && *flag {
+				err = w.emit(Event{Type: EventDelete, Dn: w.state.Entries[entryUUID], EntryUUID: entryUUID})
+				if err != nil {
+					return err
+				}
+			} else {
+				w.markPresent(entryUUID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// refreshDone ends the refresh phase
+func (w *watch) refreshDone() error {
+	w.refreshed = true
+	w.present = nil
+	return w.emit(Event{Type: EventRefreshDone})
+}
+
+// markPresent records entryUUID as present in the current present phase
+func (w *watch) markPresent(entryUUID string) {
+	if w.present == nil {
+		w.present = make(map[string]bool)
+	}
+
+	w.present[entryUUID] = true
+}
+
+// deleteMissing reports all known entries not seen during the present phase as deleted
+func (w *watch) deleteMissing() error {
+	for entryUUID, dn := range w.state.Entries {
+		if w.present[entryUUID] {
+			continue
+		}
+
+		err := w.emit(Event{Type: EventDelete, Dn: dn, EntryUUID: entryUUID})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.present = make(map[string]bool)
+	return nil
+}
+
+// handlePersistentSearch handles a message of a persistent search
+func (w *watch) handlePersistentSearch(m *ldap.SearchMessage) error {
+	if m.Entry == nil {
+		return nil
+	}
+
+	event := Event{Type: EventAdd, Dn: w.manager.removeBaseDn(m.Entry.DN)}
+
+	// entries without notification are the initial content
+	if value, ok := findControl(m.Controls, oidEntryChangeNotification); ok {
+		changeType, previousDn, err := parseEntryChangeNotification(value)
+		if err != nil {
+			return err
+		}
+
+		switch changeType {
+		case psearchAdd:
+			event.Type = EventAdd
+		case psearchDelete:
+			event.Type = EventDelete
+			return w.emit(event)
+		case psearchModify:
+			event.Type = EventModify
+		case psearchModDN:
+			event.Type = EventRename
+			event.OldDn = w.manager.removeBaseDn(previousDn)
+		}
+	}
+
+	var err error
+	event.Item, err = w.unmarshal(m.Entry)
+	if err != nil {
+		return err
+	}
+
+	return w.emit(event)
+}
+
+// newSyncRequestControl returns a sync request control for mode, resuming from cookie
+func newSyncRequestControl(mode int, cookie string) ldap.Control {
+	// syncRequestValue ::= SEQUENCE { mode ENUMERATED, cookie syncCookie OPTIONAL,
+	//     reloadHint BOOLEAN DEFAULT FALSE }
+	fields := [][]byte{berEncodeInt(berEnumerated, int64(mode))}
+	if cookie != "" {
+		fields = append(fields, berEncodeString(berOctetString, cookie))
+	}
+
+	return ldap.NewControlString(oidSyncRequest, true, string(berEncodeSequence(berSequence, fields...)))
+}
+
+// parseSyncState parses the value of a sync state control
+func parseSyncState(value string) (int, string, string, error) {
+	// syncStateValue ::= SEQUENCE { state ENUMERATED, entryUUID syncUUID,
+	//     cookie syncCookie OPTIONAL }
+	e, err := berDecodeSingle([]byte(value))
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	fields, err := e.children()
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	if len(fields) < 2 {
+		return 0, "", "", errors.New("Invalid sync state control.")
+	}
+
+	var cookie string
+	if len(fields) > 2 {
+		cookie = fields[2].string()
+	}
+
+	return int(fields[0].int()), formatUUID(fields[1].content), cookie, nil
+}
+
+// parseSyncDone parses the value of a sync done control
+func parseSyncDone(value string) (string, bool, error) {
+	// syncDoneValue ::= SEQUENCE { cookie syncCookie OPTIONAL,
+	//     refreshDeletes BOOLEAN DEFAULT FALSE }
+	e, err := berDecodeSingle([]byte(value))
+	if err != nil {
+		return "", false, err
+	}
+
+	fields, err := e.children()
+	if err != nil {
+		return "", false, err
+	}
+
+	var cookie string
+	var refreshDeletes bool
+	for _, v := range fields {
+		switch v.tag {
+		case berOctetString:
+			cookie = v.string()
+		case berBoolean:
+			refreshDeletes = v.bool()
+		}
+	}
+
+	return cookie, refreshDeletes, nil
+}
+
+// newPersistentSearchControl returns a persistent search control for all changes,
+// including the initial content and entry change notifications
+func newPersistentSearchControl() ldap.Control {
+	// PersistentSearch ::= SEQUENCE { changeTypes INTEGER, changesOnly BOOLEAN,
+	//     returnECs BOOLEAN }
+	value := berEncodeSequence(berSequence,
+		berEncodeInt(berInteger, psearchAdd|psearchDelete|psearchModify|psearchModDN),
+		berEncodeBool(berBoolean, false),
+		berEncodeBool(berBoolean, true))
+
+	return ldap.NewControlString(oidPersistentSearch, true, string(value))
+}
+
+// parseEntryChangeNotification parses the value of an entry change notification control
+func parseEntryChangeNotification(value string) (int, string, error) {
+	// EntryChangeNotification ::= SEQUENCE { changeType ENUMERATED,
+	//     previousDN LDAPDN OPTIONAL, changeNumber INTEGER OPTIONAL }
+	e, err := berDecodeSingle([]byte(value))
+	if err != nil {
+		return 0, "", err
+	}
+
+	fields, err := e.children()
+	if err != nil {
+		return 0, "", err
+	}
+
+	if len(fields) == 0 {
+		return 0, "", errors.New("Invalid entry change notification control.")
+	}
+
+	var previousDn string
+	if len(fields) > 1 && fields[1].tag == berOctetString {
+		previousDn = fields[1].string()
+	}
+
+	return int(fields[0].int()), previousDn, nil
+}
+
+// formatUUID formats a binary UUID in its usual string representation
+func formatUUID(b []byte) string {
+	if len(b) != 16 {
+		return fmt.Sprintf("%x", b)
+	}
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
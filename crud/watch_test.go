@@ -0,0 +1,155 @@
+package crud
+
+import (
+	"github.com/rbns/ldap"
+	"testing"
+)
+
+// syncStateMessage returns an entry with a sync state control
+func syncStateMessage(dn string, state int, uuid byte, cookie string) *ldap.SearchMessage {
+	fields := [][]byte{
+		berEncodeInt(berEnumerated, int64(state)),
+		berEncodeString(berOctetString, string([]byte{uuid, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})),
+	}
+	if cookie != "" {
+		fields = append(fields, berEncodeString(berOctetString, cookie))
+	}
+
+	entry := ldap.NewEntry(dn + ",dc=example,dc=com")
+	entry.AddAttributeValue("objectClass", "organizationalUnit")
+	entry.AddAttributeValue("ou", dn[3:])
+
+	control := ldap.NewControlString(oidSyncState, false, string(berEncodeSequence(berSequence, fields...)))
+	return &ldap.SearchMessage{Entry: entry, Controls: []ldap.Control{control}}
+}
+
+// syncInfoMessage returns a sync info message
+func syncInfoMessage(value []byte) *ldap.SearchMessage {
+	return &ldap.SearchMessage{Intermediate: &ldap.IntermediateResponse{Name: oidSyncInfo, Value: string(value)}}
+}
+
+func TestWatchSync(t *testing.T) {
+	var events []Event
+	state := &WatchState{Entries: map[string]string{
+		formatUUID([]byte{9, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}): "ou=gone",
+		formatUUID([]byte{2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}): "ou=old",
+	}}
+
+	w := &watch{manager: New(nil, "dc=example,dc=com"), item: NewDynamic(""), state: state, handler: func(e Event) error {
+		events = append(events, e)
+		return nil
+	}}
+
+	messages := []*ldap.SearchMessage{
+		syncStateMessage("ou=new", syncStateAdd, 1, ""),
+		syncStateMessage("ou=renamed", syncStateModify, 2, ""),
+		// refreshPresent, refreshDone defaults to true
+		syncInfoMessage(berEncodeSequence(berContext|berConstructed|2, berEncodeString(berOctetString, "cookie1"))),
+		syncStateMessage("ou=new", syncStateDelete, 1, "cookie2"),
+	}
+
+	for _, v := range messages {
+		err := w.handleSync(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []struct {
+		typ   EventType
+		dn    string
+		oldDn string
+	}{
+		{EventAdd, "ou=new", ""},
+		{EventRename, "ou=renamed", "ou=old"},
+		{EventDelete, "ou=gone", ""},
+		{EventRefreshDone, "", ""},
+		{EventDelete, "ou=new", ""},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatal("unexpected events:", events)
+	}
+
+	for i, v := range expected {
+		if events[i].Type != v.typ || events[i].Dn != v.dn || events[i].OldDn != v.oldDn {
+			t.Errorf("unexpected event %d: %+v", i, events[i])
+		}
+	}
+
+	if events[0].Item.(*Dynamic).GetValue("ou") != "new" {
+		t.Error("unexpected item:", events[0].Item)
+	}
+
+	if state.Cookie != "cookie2" || events[3].Cookie != "cookie1" {
+		t.Error("unexpected cookies:", state.Cookie, events[3].Cookie)
+	}
+
+	if len(state.Entries) != 1 || state.Entries[formatUUID([]byte{2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})] != "ou=renamed" {
+		t.Error("unexpected state:", state.Entries)
+	}
+}
+
+func TestWatchSyncBase(t *testing.T) {
+	var events []Event
+	state := &WatchState{Entries: map[string]string{
+		formatUUID([]byte{2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}): "ou=a, ou=b",
+	}}
+
+	w := &watch{manager: New(nil, "dc=example,dc=com"), item: NewDynamic(""), state: state, handler: func(e Event) error {
+		events = append(events, e)
+		return nil
+	}}
+
+	// the base entry itself, as seen when watching from the base
+	base := syncStateMessage("ou=base", syncStateModify, 1, "")
+	base.Entry.DN = "dc=example,dc=com"
+
+	// a DN differing only in case and spacing isn't a rename
+	modified := syncStateMessage("ou=a", syncStateModify, 2, "")
+	modified.Entry.DN = "OU=a,ou=b,dc=example,dc=com"
+
+	for _, v := range []*ldap.SearchMessage{base, modified} {
+		err := w.handleSync(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(events) != 2 || events[0].Type != EventModify || events[0].Dn != "" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	if events[1].Type != EventModify || events[1].Dn != "OU=a,ou=b" {
+		t.Errorf("unexpected event: %+v", events[1])
+	}
+}
+
+func TestWatchPersistentSearch(t *testing.T) {
+	var events []Event
+	w := &watch{manager: New(nil, "dc=example,dc=com"), item: NewDynamic(""), state: &WatchState{}, handler: func(e Event) error {
+		events = append(events, e)
+		return nil
+	}}
+
+	message := syncStateMessage("ou=moved", 0, 0, "")
+	notification := berEncodeSequence(berSequence, berEncodeInt(berEnumerated, psearchModDN),
+		berEncodeString(berOctetString, "ou=old,dc=example,dc=com"))
+	message.Controls = []ldap.Control{ldap.NewControlString(oidEntryChangeNotification, false, string(notification))}
+
+	err := w.handlePersistentSearch(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].Type != EventRename || events[0].Dn != "ou=moved" || events[0].OldDn != "ou=old" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestFormatUUID(t *testing.T) {
+	uuid := formatUUID([]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0})
+	if uuid != "12345678-9abc-def0-1234-56789abcdef0" {
+		t.Error("unexpected uuid:", uuid)
+	}
+}
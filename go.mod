@@ -0,0 +1,5 @@
+module github.com/bytemine/ldap-crud
+
+go 1.13
+
+require github.com/rbns/ldap master
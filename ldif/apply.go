@@ -0,0 +1,80 @@
+package ldif
+
+import (
+	"github.com/rbns/ldap"
+	"io"
+)
+
+// An Executor sends the requests of change records, e.g. an *ldap.Connection.
+type Executor interface {
+	Add(*ldap.AddRequest) error
+	Modify(*ldap.ModifyRequest) error
+	Delete(*ldap.DeleteRequest) error
+	ModifyDN(*ldap.ModifyDNRequest) error
+}
+
+// Result is the outcome of applying a record.
+type Result struct {
+	// Line the record starts at
+	Line int
+
+	// DN and change type of the record, empty if it couldn't be parsed
+	Dn         string
+	ChangeType string
+
+	Err error
+}
+
+// Apply sends the request for the record with e. Content records are added.
+func (r *Record) Apply(e Executor) error {
+	switch r.ChangeType {
+	case "", ChangeAdd:
+		addRequest := ldap.NewAddRequest(r.Dn)
+		addRequest.Entry.Attributes = r.Entry.Attributes
+		addRequest.Controls = r.Controls
+		return e.Add(addRequest)
+	case ChangeDelete:
+		deleteRequest := ldap.NewDeleteRequest(r.Dn)
+		deleteRequest.Controls = r.Controls
+		return e.Delete(deleteRequest)
+	case ChangeModify:
+		modifyRequest := ldap.NewModifyRequest(r.Dn)
+		modifyRequest.Mods = r.Mods
+		modifyRequest.Controls = r.Controls
+		return e.Modify(modifyRequest)
+	}
+
+	modifyDNRequest := ldap.NewModifyDNRequest(r.Dn, r.NewRdn, r.DeleteOldRdn, r.NewSuperior)
+	modifyDNRequest.Controls = r.Controls
+	return e.ModifyDN(modifyDNRequest)
+}
+
+// Apply reads the records from r and applies them in order with e. The result of
+// every record read is returned. Unless continueOnError is set, Apply stops at the
+// first record which can't be parsed or applied and returns its error as well.
+func Apply(e Executor, r *Reader, continueOnError bool) ([]Result, error) {
+	var results []Result
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return results, nil
+		}
+
+		var result Result
+		if parseErr, ok := err.(*ParseError); ok {
+			result = Result{Line: parseErr.Line, Err: err}
+		} else if err != nil {
+			return results, err
+		} else {
+			result = Result{Line: record.Line, Dn: record.Dn, ChangeType: record.ChangeType, Err: record.Apply(e)}
+			if result.ChangeType == "" {
+				result.ChangeType = ChangeAdd
+			}
+		}
+
+		results = append(results, result)
+		if result.Err != nil && !continueOnError {
+			return results, result.Err
+		}
+	}
+}
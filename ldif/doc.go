@@ -0,0 +1,11 @@
+/*
+Package ldif reads and writes the LDAP Data Interchange Format (LDIF) as defined
+in RFC 2849 [1].
+
+The Writer writes entries as content records and changes as change records,
+encoding unsafe values with base64 and folding long lines. The Reader reads content and change records, which can be
+applied to a server with Apply.
+
+[1] https://www.ietf.org/rfc/rfc2849.txt
+*/
+package ldif
@@ -0,0 +1,418 @@
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/rbns/ldap"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Change types of change records
+const (
+	ChangeAdd    = "add"
+	ChangeDelete = "delete"
+	ChangeModify = "modify"
+	ChangeModRdn = "modrdn"
+)
+
+// A Record is a content or change record.
+type Record struct {
+	// Line the record starts at
+	Line int
+
+	Dn string
+
+	// Controls to send with a change record
+	Controls []ldap.Control
+
+	// Change type of a change record, empty for content records
+	ChangeType string
+
+	// Attributes of content and add records, with the DN of the record
+	Entry *ldap.Entry
+
+	// Modifications of modify records
+	Mods []ldap.Mod
+
+	// New RDN and superior of modrdn records
+	NewRdn       string
+	DeleteOldRdn bool
+	NewSuperior  string
+}
+
+// A ParseError is returned for a record which can't be parsed.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("LDIF line %d: %v", e.Line, e.Err)
+}
+
+// A Reader reads LDIF records.
+type Reader struct {
+	// Directory values given as file:// URLs are read from. Files outside of it are
+	// refused. If empty, values given as URLs are refused.
+	URLBase string
+
+	r    *bufio.Reader
+	line int
+
+	// true after the first record, to recognize the version line
+	started bool
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read reads the next record. At the end of the input, io.EOF is returned. After a
+// *ParseError, reading continues with the next record.
+//
+// Values given as file:// URLs are read from the file if it is in URLBase.
+func (r *Reader) Read() (*Record, error) {
+	for {
+		lines, start, err := r.readLines()
+		if err != nil {
+			return nil, err
+		}
+
+		if !r.started {
+			r.started = true
+
+			if strings.HasPrefix(strings.ToLower(lines[0]), "version:") {
+				if strings.TrimSpace(lines[0][len("version:"):]) != "1" {
+					return nil, &ParseError{Line: start, Err: errors.New("Unsupported LDIF version.")}
+				}
+
+				lines = lines[1:]
+				start++
+				if len(lines) == 0 {
+					continue
+				}
+			}
+		}
+
+		record, err := r.parseRecord(lines)
+		if err != nil {
+			return nil, &ParseError{Line: start, Err: err}
+		}
+
+		record.Line = start
+		return record, nil
+	}
+}
+
+// readLines reads the unfolded lines of the next record, without comments, and the
+// line number of its first line
+func (r *Reader) readLines() ([]string, int, error) {
+	var lines []string
+	var start int
+	var comment bool
+
+	for {
+		line, err := r.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			if len(lines) > 0 {
+				return lines, start, nil
+			}
+
+			return nil, 0, io.EOF
+		} else if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		r.line++
+
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if len(lines) > 0 {
+				return lines, start, nil
+			}
+			comment = false
+		case line[0] == ' ':
+			if comment {
+				continue
+			}
+
+			if len(lines) == 0 {
+				return nil, 0, &ParseError{Line: r.line, Err: errors.New("Continuation without line.")}
+			}
+
+			lines[len(lines)-1] += line[1:]
+		case line[0] == '#':
+			comment = true
+		default:
+			comment = false
+			if len(lines) == 0 {
+				start = r.line
+			}
+
+			lines = append(lines, line)
+		}
+	}
+}
+
+// parseRecord parses the lines of a record
+func (r *Reader) parseRecord(lines []string) (*Record, error) {
+	name, dn, err := r.parseLine(lines[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(name, "dn") {
+		return nil, errors.New("Record doesn't start with dn.")
+	}
+
+	record := &Record{Dn: dn}
+	lines = lines[1:]
+
+	for len(lines) > 0 && strings.HasPrefix(strings.ToLower(lines[0]), "control:") {
+		control, err := r.parseControl(lines[0][len("control:"):])
+		if err != nil {
+			return nil, err
+		}
+
+		record.Controls = append(record.Controls, control)
+		lines = lines[1:]
+	}
+
+	if len(lines) > 0 {
+		name, value, err := r.parseLine(lines[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.EqualFold(name, "changetype") {
+			record.ChangeType = strings.ToLower(value)
+			lines = lines[1:]
+		}
+	}
+
+	if len(record.Controls) > 0 && record.ChangeType == "" {
+		return nil, errors.New("Controls in content record.")
+	}
+
+	switch record.ChangeType {
+	case "", ChangeAdd:
+		record.Entry = ldap.NewEntry(dn)
+		for _, v := range lines {
+			name, value, err := r.parseLine(v)
+			if err != nil {
+				return nil, err
+			}
+
+			record.Entry.AddAttributeValue(name, value)
+		}
+	case ChangeDelete:
+		if len(lines) > 0 {
+			return nil, errors.New("Values in delete record.")
+		}
+	case ChangeModify:
+		record.Mods, err = r.parseMods(lines)
+		if err != nil {
+			return nil, err
+		}
+	case ChangeModRdn, "moddn":
+		record.ChangeType = ChangeModRdn
+		err = r.parseModRdn(record, lines)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown change type %q.", record.ChangeType)
+	}
+
+	return record, nil
+}
+
+// parseMods parses the modifications of a modify record
+func (r *Reader) parseMods(lines []string) ([]ldap.Mod, error) {
+	var mods []ldap.Mod
+	for len(lines) > 0 {
+		op, attr, err := r.parseLine(lines[0])
+		if err != nil {
+			return nil, err
+		}
+		lines = lines[1:]
+
+		var operation int
+		switch strings.ToLower(op) {
+		case "add":
+			operation = ldap.ModAdd
+		case "delete":
+			operation = ldap.ModDelete
+		case "replace":
+			operation = ldap.ModReplace
+		default:
+			return nil, fmt.Errorf("Unsupported modification %q.", op)
+		}
+
+		var values []string
+		for len(lines) > 0 && lines[0] != "-" {
+			name, value, err := r.parseLine(lines[0])
+			if err != nil {
+				return nil, err
+			}
+
+			if !strings.EqualFold(name, attr) {
+				return nil, fmt.Errorf("Value of %v in modification of %v.", name, attr)
+			}
+
+			values = append(values, value)
+			lines = lines[1:]
+		}
+
+		// the separator may be missing after the last modification
+		if len(lines) > 0 {
+			lines = lines[1:]
+		}
+
+		mods = append(mods, *ldap.NewMod(operation, attr, values))
+	}
+
+	return mods, nil
+}
+
+// parseModRdn parses the lines of a modrdn record into record
+func (r *Reader) parseModRdn(record *Record, lines []string) error {
+	var deleteOldRdn bool
+	for _, v := range lines {
+		name, value, err := r.parseLine(v)
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(name) {
+		case "newrdn":
+			record.NewRdn = value
+		case "deleteoldrdn":
+			if value != "0" && value != "1" {
+				return fmt.Errorf("Invalid deleteoldrdn %q.", value)
+			}
+
+			record.DeleteOldRdn = value == "1"
+			deleteOldRdn = true
+		case "newsuperior":
+			record.NewSuperior = value
+		default:
+			return fmt.Errorf("Unexpected %v in modrdn record.", name)
+		}
+	}
+
+	if record.NewRdn == "" {
+		return errors.New("Missing newrdn in modrdn record.")
+	}
+
+	// deleteoldrdn is required (RFC 2849)
+	if !deleteOldRdn {
+		return errors.New("Missing deleteoldrdn in modrdn record.")
+	}
+
+	return nil
+}
+
+// parseControl parses the value of a control line:
+// oid [true|false] [value-spec]
+func (r *Reader) parseControl(s string) (ldap.Control, error) {
+	var valueSpec string
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		s, valueSpec = s[:i], s[i:]
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, errors.New("Invalid control.")
+	}
+
+	criticality := false
+	if len(fields) == 2 {
+		switch fields[1] {
+		case "true":
+			criticality = true
+		case "false":
+		default:
+			return nil, errors.New("Invalid control criticality.")
+		}
+	}
+
+	var value string
+	if valueSpec != "" {
+		var err error
+		value, err = r.decodeValue(valueSpec[1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ldap.NewControlString(fields[0], criticality, value), nil
+}
+
+// parseLine splits a line into the attribute description and the decoded value
+func (r *Reader) parseLine(line string) (string, string, error) {
+	i := strings.IndexByte(line, ':')
+	if i < 1 {
+		return "", "", fmt.Errorf("Invalid line %q.", line)
+	}
+
+	value, err := r.decodeValue(line[i+1:])
+	return line[:i], value, err
+}
+
+// decodeValue decodes a value-spec without the first colon
+func (r *Reader) decodeValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, ":"):
+		b, err := base64.StdEncoding.DecodeString(strings.TrimLeft(s[1:], " "))
+		return string(b), err
+	case strings.HasPrefix(s, "<"):
+		return r.readURL(strings.TrimLeft(s[1:], " "))
+	}
+
+	return strings.TrimLeft(s, " "), nil
+}
+
+// readURL reads the value a URL refers to, only file:// URLs of files in URLBase
+// are supported
+func (r *Reader) readURL(s string) (string, error) {
+	if r.URLBase == "" {
+		return "", fmt.Errorf("URL values are disabled: %q.", s)
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("Unsupported URL %q.", s)
+	}
+
+	// symbolic links are resolved, so they can't point out of URLBase
+	base, err := filepath.EvalSymlinks(r.URLBase)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := filepath.EvalSymlinks(u.Path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("URL %q is outside of %v.", s, r.URLBase)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	return string(b), err
+}
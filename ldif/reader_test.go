@@ -0,0 +1,219 @@
+package ldif
+
+import (
+	"errors"
+	"github.com/rbns/ldap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	photo, err := ioutil.TempFile("", "photo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(photo.Name())
+	photo.Write([]byte{0xff, 0xd8})
+	photo.Close()
+
+	input := `version: 1
+
+# a comment
+ continued
+dn: cn=Fritz Foobar,dc=exa
+ mple,dc=com
+objectClass: person
+cn: Fritz Foobar
+sn:: TcO8bGxlcg==
+jpegPhoto:< file://` + photo.Name() + `
+
+dn: cn=Fritz Foobar,dc=example,dc=com
+control: 1.3.6.1.4.1.4203.1.10.2 true
+changetype: modify
+add: description
+description: first
+description: second
+-
+delete: telephoneNumber
+-
+replace: sn
+sn: Foobar
+-
+
+dn: cn=Fritz Foobar,dc=example,dc=com
+changetype: moddn
+newrdn: cn=Fritz
+deleteoldrdn: 1
+newsuperior: ou=People,dc=example,dc=com
+
+dn: cn=Fritz,ou=People,dc=example,dc=com
+changetype: delete
+`
+
+	r := NewReader(strings.NewReader(input))
+	r.URLBase = filepath.Dir(photo.Name())
+
+	add, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if add.Line != 5 || add.Dn != "cn=Fritz Foobar,dc=example,dc=com" || add.ChangeType != "" {
+		t.Errorf("unexpected record: %+v", add)
+	}
+
+	if add.Entry.GetAttributeValue("sn") != "Müller" || add.Entry.GetAttributeValue("jpegPhoto") != "\xff\xd8" {
+		t.Errorf("unexpected entry: %+v", add.Entry)
+	}
+
+	modify, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if modify.ChangeType != ChangeModify || len(modify.Controls) != 1 || len(modify.Mods) != 3 {
+		t.Fatalf("unexpected record: %+v", modify)
+	}
+
+	if modify.Mods[0].ModOperation != ldap.ModAdd || len(modify.Mods[0].Modification.Values) != 2 ||
+		modify.Mods[1].ModOperation != ldap.ModDelete || len(modify.Mods[1].Modification.Values) != 0 ||
+		modify.Mods[2].ModOperation != ldap.ModReplace || modify.Mods[2].Modification.Values[0] != "Foobar" {
+		t.Errorf("unexpected modifications: %+v", modify.Mods)
+	}
+
+	modrdn, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if modrdn.ChangeType != ChangeModRdn || modrdn.NewRdn != "cn=Fritz" || !modrdn.DeleteOldRdn ||
+		modrdn.NewSuperior != "ou=People,dc=example,dc=com" {
+		t.Errorf("unexpected record: %+v", modrdn)
+	}
+
+	del, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if del.ChangeType != ChangeDelete || del.Dn != "cn=Fritz,ou=People,dc=example,dc=com" {
+		t.Errorf("unexpected record: %+v", del)
+	}
+
+	_, err = r.Read()
+	if err != io.EOF {
+		t.Error("expected io.EOF, got", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	input := "dn: ou=a\nchangetype: rename\n\nou: b\n\ndn: ou=b\nchangetype: modrdn\nnewrdn: ou=d\n\ndn: ou=c\nou: c\n"
+	r := NewReader(strings.NewReader(input))
+
+	for _, line := range []int{1, 4, 6} {
+		_, err := r.Read()
+		if e, ok := err.(*ParseError); !ok || e.Line != line {
+			t.Errorf("expected parse error in line %d, got %v", line, err)
+		}
+	}
+
+	record, err := r.Read()
+	if err != nil || record.Dn != "ou=c" {
+		t.Error("expected to continue after errors, got", record, err)
+	}
+}
+
+// executor records the requests it gets and fails for some DNs
+type executor struct {
+	requests []string
+	fail     map[string]bool
+}
+
+func (e *executor) do(kind, dn string) error {
+	e.requests = append(e.requests, kind+" "+dn)
+	if e.fail[dn] {
+		return errors.New("failed")
+	}
+
+	return nil
+}
+
+func (e *executor) Add(r *ldap.AddRequest) error           { return e.do("add", r.Entry.DN) }
+func (e *executor) Modify(r *ldap.ModifyRequest) error     { return e.do("modify", r.DN) }
+func (e *executor) Delete(r *ldap.DeleteRequest) error     { return e.do("delete", r.DN) }
+func (e *executor) ModifyDN(r *ldap.ModifyDNRequest) error { return e.do("modrdn", r.DN) }
+
+func TestApply(t *testing.T) {
+	input := "dn: ou=a\nou: a\n\ndn: ou=b\nchangetype: delete\n\ndn: ou=c\nchangetype: modrdn\nnewrdn: ou=d\ndeleteoldrdn: 0\n"
+
+	e := &executor{fail: map[string]bool{"ou=b": true}}
+	results, err := Apply(e, NewReader(strings.NewReader(input)), false)
+	if err == nil || len(results) != 2 || len(e.requests) != 2 {
+		t.Error("expected Apply to stop at the first error:", results, err)
+	}
+
+	e = &executor{fail: map[string]bool{"ou=b": true}}
+	results, err = Apply(e, NewReader(strings.NewReader(input)), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 || results[0].ChangeType != ChangeAdd || results[0].Err != nil || results[1].Err == nil ||
+		results[2].Line != 7 || results[2].ChangeType != ChangeModRdn {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	if strings.Join(e.requests, ",") != "add ou=a,delete ou=b,modrdn ou=c" {
+		t.Error("unexpected requests:", e.requests)
+	}
+}
+
+func TestReadURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inside := filepath.Join(dir, "inside")
+	err = ioutil.WriteFile(inside, []byte("inside"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outside, err := ioutil.TempFile("", "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outside.Name())
+	outside.Close()
+
+	// a link in the base directory mustn't lead out of it
+	link := filepath.Join(dir, "link")
+	err = os.Symlink(outside.Name(), link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(base, path string) (*Record, error) {
+		r := NewReader(strings.NewReader("dn: ou=a\ndescription:< file://" + path + "\n"))
+		r.URLBase = base
+		return r.Read()
+	}
+
+	record, err := read(dir, inside)
+	if err != nil || record.Entry.GetAttributeValue("description") != "inside" {
+		t.Error("unexpected record:", record, err)
+	}
+
+	for _, v := range []struct{ base, path string }{{"", inside}, {dir, outside.Name()}, {dir, link}} {
+		_, err := read(v.base, v.path)
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("expected parse error for %v in %q, got %v", v.path, v.base, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"github.com/rbns/ldap"
+	"io"
+	"strings"
+)
+
+// Operational attributes commonly maintained by servers, which are left out by
+// a Writer unless Operational is set.
+var OperationalAttributes = []string{
+	"createTimestamp", "creatorsName", "modifyTimestamp", "modifiersName",
+	"entryUUID", "entryCSN", "entryDN", "structuralObjectClass", "hasSubordinates",
+	"subschemaSubentry", "contextCSN", "numSubordinates", "pwdChangedTime",
+	"pwdAccountLockedTime", "pwdFailureTime", "pwdHistory", "pwdGraceUseTime",
+	"pwdReset", "pwdPolicySubentry",
+}
+
+// IsOperational reports if the attribute description name refers to one of
+// OperationalAttributes.
+func IsOperational(name string) bool {
+	if i := strings.IndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+
+	for _, v := range OperationalAttributes {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A Writer writes LDIF records.
+type Writer struct {
+	// Lines longer than Width are folded. No folding if 0.
+	Width int
+
+	// Write operational attributes.
+	Operational bool
+
+	w       *bufio.Writer
+	records int
+}
+
+// NewWriter returns a Writer writing to w, folding lines at 76 characters.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{Width: 76, w: bufio.NewWriter(w)}
+}
+
+// WriteEntry writes e as content record.
+func (w *Writer) WriteEntry(e *ldap.Entry) error {
+	w.beginRecord()
+	w.writeValue("dn", e.DN)
+	w.writeAttributes(e.Attributes, w.Operational)
+	return w.endRecord()
+}
+
+// WriteRecord writes r as content or change record. Change records are written
+// with all attributes, regardless of Operational.
+func (w *Writer) WriteRecord(r *Record) error {
+	if r.ChangeType == "" {
+		entry := *r.Entry
+		entry.DN = r.Dn
+		return w.WriteEntry(&entry)
+	}
+
+	w.beginRecord()
+	w.writeValue("dn", r.Dn)
+
+	for _, v := range r.Controls {
+		w.writeControl(v)
+	}
+
+	w.writeLine("changetype: " + r.ChangeType)
+
+	switch r.ChangeType {
+	case ChangeAdd:
+		w.writeAttributes(r.Entry.Attributes, true)
+	case ChangeModify:
+		for _, v := range r.Mods {
+			switch v.ModOperation {
+			case ldap.ModAdd:
+				w.writeLine("add: " + v.Modification.Name)
+			case ldap.ModDelete:
+				w.writeLine("delete: " + v.Modification.Name)
+			case ldap.ModReplace:
+				w.writeLine("replace: " + v.Modification.Name)
+			}
+
+			for _, value := range v.Modification.Values {
+				w.writeValue(v.Modification.Name, value)
+			}
+
+			w.writeLine("-")
+		}
+	case ChangeModRdn:
+		w.writeValue("newrdn", r.NewRdn)
+		if r.DeleteOldRdn {
+			w.writeLine("deleteoldrdn: 1")
+		} else {
+			w.writeLine("deleteoldrdn: 0")
+		}
+
+		if r.NewSuperior != "" {
+			w.writeValue("newsuperior", r.NewSuperior)
+		}
+	}
+
+	return w.endRecord()
+}
+
+// beginRecord writes the version line before the first record and the empty
+// line separating records
+func (w *Writer) beginRecord() {
+	if w.records == 0 {
+		w.writeLine("version: 1")
+	}
+
+	w.w.WriteString("\n")
+	w.records++
+}
+
+// endRecord flushes the record
+func (w *Writer) endRecord() error {
+	return w.w.Flush()
+}
+
+// writeAttributes writes the values of attrs, operational attributes only if
+// operational is set
+func (w *Writer) writeAttributes(attrs []*ldap.EntryAttribute, operational bool) {
+	for _, a := range attrs {
+		if !operational && IsOperational(a.Name) {
+			continue
+		}
+
+		for _, v := range a.Values {
+			w.writeValue(a.Name, v)
+		}
+	}
+}
+
+// writeValue writes an attribute value line, with the value base64 encoded if
+// it isn't safe
+func (w *Writer) writeValue(name, value string) {
+	if IsSafe(value) {
+		w.writeLine(name + ": " + value)
+	} else {
+		w.writeLine(name + ":: " + base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+}
+
+// writeControl writes a control line
+func (w *Writer) writeControl(control ldap.Control) {
+	line := "control: " + control.GetControlType()
+
+	if c, ok := control.(*ldap.ControlString); ok {
+		if c.Criticality {
+			line += " true"
+		} else {
+			line += " false"
+		}
+
+		if c.ControlValue != "" {
+			if IsSafe(c.ControlValue) {
+				line += ": " + c.ControlValue
+			} else {
+				line += ":: " + base64.StdEncoding.EncodeToString([]byte(c.ControlValue))
+			}
+		}
+	}
+
+	w.writeLine(line)
+}
+
+// writeLine writes line, folded at Width. Continuation lines start with a space.
+func (w *Writer) writeLine(line string) {
+	width := w.Width
+	for w.Width > 1 && len(line) > width {
+		w.w.WriteString(line[:width])
+		w.w.WriteString("\n ")
+
+		line = line[width:]
+		width = w.Width - 1
+	}
+
+	w.w.WriteString(line)
+	w.w.WriteString("\n")
+}
+
+// IsSafe reports if value can be written without base64 encoding: it has to be
+// a SAFE-STRING (RFC 2849) and must not end with a space.
+func IsSafe(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	switch value[0] {
+	case ' ', ':', '<':
+		return false
+	}
+
+	if value[len(value)-1] == ' ' {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == 0 || c == '\n' || c == '\r' || c >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,123 @@
+package ldif
+
+import (
+	"bytes"
+	"github.com/rbns/ldap"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestIsSafe(t *testing.T) {
+	tests := map[string]bool{
+		"":             true,
+		"Fritz Foobar": true,
+		" leading":     false,
+		"trailing ":    false,
+		":colon":       false,
+		"<less":        false,
+		"new\nline":    false,
+		"Müller":       false,
+		"a:b<c":        true,
+	}
+
+	for k, v := range tests {
+		if IsSafe(k) != v {
+			t.Errorf("%q: expected %v", k, v)
+		}
+	}
+}
+
+func TestWriteEntry(t *testing.T) {
+	e := ldap.NewEntry("cn=Fritz,dc=example,dc=com")
+	e.AddAttributeValues("objectClass", []string{"top", "person"})
+	e.AddAttributeValue("sn", "Müller")
+	e.AddAttributeValue("description", strings.Repeat("x", 100))
+	e.AddAttributeValue("entryUUID", "6f1d5d5c-6a7b-103b-8b5a-9b1c1c1c1c1c")
+
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	err := w.WriteEntry(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "version: 1\n\n" +
+		"dn: cn=Fritz,dc=example,dc=com\n" +
+		"objectClass: top\n" +
+		"objectClass: person\n" +
+		"sn:: TcO8bGxlcg==\n" +
+		"description: " + strings.Repeat("x", 63) + "\n " + strings.Repeat("x", 37) + "\n"
+
+	if b.String() != expected {
+		t.Errorf("unexpected LDIF:\n%v", b.String())
+	}
+
+	b.Reset()
+	w = NewWriter(&b)
+	w.Operational = true
+	w.Width = 0
+	w.WriteEntry(e)
+	w.WriteEntry(ldap.NewEntry("dc=example,dc=com"))
+
+	if !strings.Contains(b.String(), "\nentryUUID: 6f1d5d5c") || !strings.Contains(b.String(), strings.Repeat("x", 100)) {
+		t.Errorf("unexpected LDIF:\n%v", b.String())
+	}
+
+	if !strings.HasSuffix(b.String(), "\n\ndn: dc=example,dc=com\n") {
+		t.Errorf("records not separated:\n%v", b.String())
+	}
+}
+
+func TestWriteRecord(t *testing.T) {
+	input := `version: 1
+
+dn: ou=a,dc=example,dc=com
+changetype: add
+objectClass: organizationalUnit
+ou: a
+entryUUID: 6f1d5d5c-6a7b-103b-8b5a-9b1c1c1c1c1c
+
+dn: ou=a,dc=example,dc=com
+control: 1.3.6.1.4.1.4203.1.10.2 true
+control: 2.16.840.1.113730.3.4.18 true: dn:cn=Foo
+changetype: modify
+add: description
+description: first
+description:: c2Vjb25kIA==
+-
+delete: telephoneNumber
+-
+
+dn: ou=a,dc=example,dc=com
+changetype: modrdn
+newrdn: ou=b
+deleteoldrdn: 1
+newsuperior: ou=People,dc=example,dc=com
+
+dn: ou=b,ou=People,dc=example,dc=com
+changetype: delete
+`
+
+	r := NewReader(strings.NewReader(input))
+
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		err = w.WriteRecord(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if b.String() != input {
+		t.Errorf("unexpected LDIF:\n%v", b.String())
+	}
+}
@@ -1,5 +1,30 @@
 package main
 
+import (
+	"strings"
+)
+
+// syntaxes of attributes with values which aren't strings
+var binarySyntaxes = map[string]bool{
+	"1.3.6.1.4.1.1466.115.121.1.4":  true, // Audio
+	"1.3.6.1.4.1.1466.115.121.1.5":  true, // Binary
+	"1.3.6.1.4.1.1466.115.121.1.8":  true, // Certificate
+	"1.3.6.1.4.1.1466.115.121.1.9":  true, // Certificate List
+	"1.3.6.1.4.1.1466.115.121.1.10": true, // Certificate Pair
+	"1.3.6.1.4.1.1466.115.121.1.23": true, // Fax
+	"1.3.6.1.4.1.1466.115.121.1.28": true, // JPEG
+	"1.3.6.1.4.1.1466.115.121.1.40": true, // Octet String
+	"1.3.6.1.4.1.1466.115.121.1.49": true, // Supported Algorithm
+}
+
+// syntaxes of attributes which must be transferred with the ";binary" option (RFC 4522)
+var transferBinarySyntaxes = map[string]bool{
+	"1.3.6.1.4.1.1466.115.121.1.8":  true, // Certificate
+	"1.3.6.1.4.1.1466.115.121.1.9":  true, // Certificate List
+	"1.3.6.1.4.1.1466.115.121.1.10": true, // Certificate Pair
+	"1.3.6.1.4.1.1466.115.121.1.49": true, // Supported Algorithm
+}
+
 // attributetypes are generated by the parser from the schema source
 type attributetype struct {
 	Name               []string
@@ -46,3 +71,34 @@ func newAttributetype(m map[int]interface{}) *attributetype {
 	}
 	return &a
 }
+
+// syntax returns the syntax oid of the attributetype without a length constraint. If the
+// attributetype has no syntax of its own, the syntax is inherited from its SUP chain.
+func (a *attributetype) syntax() string {
+	syntax := a.Syntax
+	seen := map[*attributetype]bool{a: true}
+	for t := a; syntax == "" && t.Sup != ""; {
+		sup, ok := attributetypedefs[strings.ToLower(t.Sup)]
+		if !ok || seen[sup] {
+			break
+		}
+		seen[sup] = true
+		t = sup
+		syntax = t.Syntax
+	}
+
+	if i := strings.Index(syntax, "{"); i >= 0 {
+		return syntax[:i]
+	}
+	return syntax
+}
+
+// Binary reports if values of the attributetype are binary data instead of strings
+func (a *attributetype) Binary() bool {
+	return binarySyntaxes[a.syntax()]
+}
+
+// TransferBinary reports if the attributetype must be transferred with the ";binary" option
+func (a *attributetype) TransferBinary() bool {
+	return transferBinarySyntaxes[a.syntax()]
+}
@@ -61,9 +61,9 @@ The struct contains exported boolean fields for every object class it represents
 The struct contains every attribute of the object classes it represents as exported field.
 If an attribute is marked as single-valued in the schema, the field has the type string.
 Otherwise it has the type []string. If an attribute is used in the object class, but is not
-defined in a read schema, it has also the type []string. No further distinctions are made so
-far. Maybe at a later point, also the syntax definiton [4] of attributes will be considered,
-but I don't know of any LDAP client that does this.
+defined in a read schema, it has also the type []string. Attributes with a binary syntax
+definition [4] (e.g. Binary, Octet String, JPEG or Certificate), own or inherited through SUP,
+have the types []byte and [][]byte instead. Attributes with a Certificate syntax are transferred with the ";binary" option.
 
 The generated methods are the following:
 
@@ -94,9 +94,15 @@ Example:
 
 Would generate this code:
 	func (o *User) FormatDn() {
-		o.dn = fmt.Sprintf("sn=%v,sn=%v", []string{o.Sn, o.Sn}...)
+		var v0 string
+		if len(o.Sn) > 0 {
+			v0 = o.Sn[0]
+		}
+		o.dn = fmt.Sprintf("sn=%v", v0)
 	}
 
+Attributes which aren't single-valued contribute their first value.
+
 
 [1] https://github.com/bytemine/ldap-crud/crud
 
@@ -3,7 +3,7 @@ package objects
 /*
 autogenerated from:
 schema files:
-core.schema nis.schema
+core.schema inetorgperson.schema nis.schema
 
 object description:
 [
@@ -11,7 +11,17 @@ object description:
 	"Name": "User",
 	"Desc": "A user with several extensions",
 	"ObjectClasses": ["posixAccount","person"],
-	"FilterObjectClass": "posixAccount"
+	"FilterObjectClass": "posixAccount",
+	"DNFormat":"sn=%v",
+	"DNAttributes":["sn"]
+},
+{
+	"Name": "Employee",
+	"Desc": "A person with a photo and certificates",
+	"ObjectClasses": ["inetOrgPerson"],
+	"FilterObjectClass": "inetOrgPerson",
+	"DNFormat":"uid=%v",
+	"DNAttributes":["uid"]
 }
 ]
 
@@ -100,6 +110,14 @@ func (o *User) Dn() string {
 	return o.dn
 }
 
+func (o *User) FormatDn() {
+	var v0 string
+	if len(o.Sn) > 0 {
+		v0 = o.Sn[0]
+	}
+	o.dn = fmt.Sprintf("sn=%v", v0)
+}
+
 func (o *User) MarshalLDAP() (*ldap.Entry, error) {
 	e := ldap.NewEntry(o.dn)
 
@@ -174,3 +192,234 @@ func (o *User) UnmarshalLDAP(e *ldap.Entry) error {
 	o.UserPassword = e.GetAttributeValues("userPassword")
 	return nil
 }
+
+// Employee: A person with a photo and certificates
+type Employee struct {
+	dn            string
+	InetOrgPerson bool
+
+	// MAY attributes
+	// attribute definition missing
+	Audio []string `json:",omitempty"`
+	// RFC2256: business category
+	BusinessCategory []string `json:",omitempty"`
+	// RFC2798: vehicle license or registration plate
+	CarLicense []string `json:",omitempty"`
+	// RFC2798: identifies a department within an organization
+	DepartmentNumber []string `json:",omitempty"`
+	// RFC2798: preferred name to be used when displaying entries
+	DisplayName string `json:",omitempty"`
+	// RFC2798: numerically identifies an employee within an organization
+	EmployeeNumber string `json:",omitempty"`
+	// RFC2798: type of employment for a person
+	EmployeeType []string `json:",omitempty"`
+	// RFC2256: first name(s) for which the entity is known by
+	GivenName []string `json:",omitempty"`
+	// attribute definition missing
+	HomePhone []string `json:",omitempty"`
+	// attribute definition missing
+	HomePostalAddress []string `json:",omitempty"`
+	// RFC2256: initials of some or all of names, but not the surname(s).
+	Initials []string `json:",omitempty"`
+	// RFC2798: a JPEG image
+	JpegPhoto [][]byte `json:",omitempty"`
+	// attribute definition missing
+	LabeledURI []string `json:",omitempty"`
+	// RFC1274: RFC822 Mailbox
+	Mail []string `json:",omitempty"`
+	// attribute definition missing
+	Manager []string `json:",omitempty"`
+	// attribute definition missing
+	Mobile []string `json:",omitempty"`
+	// RFC2256: organization this object belongs to
+	O []string `json:",omitempty"`
+	// attribute definition missing
+	Pager []string `json:",omitempty"`
+	// attribute definition missing
+	Photo []string `json:",omitempty"`
+	// RFC2798: preferred written or spoken language for a person
+	PreferredLanguage string `json:",omitempty"`
+	// attribute definition missing
+	RoomNumber []string `json:",omitempty"`
+	// attribute definition missing
+	Secretary []string `json:",omitempty"`
+	// attribute definition missing
+	Uid []string `json:",omitempty"`
+	// RFC2256: X.509 user certificate, use ;binary
+	UserCertificate [][]byte `json:",omitempty"`
+	// RFC2798: personal identity information, a PKCS 12 PFX
+	UserPKCS12 [][]byte `json:",omitempty"`
+	// RFC2798: PKCS7 SignedData used to support S/MIME
+	UserSMIMECertificate [][]byte `json:",omitempty"`
+	// RFC2256: X.500 unique identifier
+	X500uniqueIdentifier []string `json:",omitempty"`
+}
+
+func NewEmployee(dn string) *Employee {
+	o := new(Employee)
+	o.dn = dn
+	return o
+}
+
+func (o *Employee) FilterObjectClass() string {
+	return "inetOrgPerson"
+}
+
+func (o *Employee) Copy() crud.Item {
+	c := NewEmployee(o.dn)
+
+	c.Audio = make([]string, len(o.Audio))
+	copy(c.Audio, o.Audio)
+	c.BusinessCategory = make([]string, len(o.BusinessCategory))
+	copy(c.BusinessCategory, o.BusinessCategory)
+	c.CarLicense = make([]string, len(o.CarLicense))
+	copy(c.CarLicense, o.CarLicense)
+	c.DepartmentNumber = make([]string, len(o.DepartmentNumber))
+	copy(c.DepartmentNumber, o.DepartmentNumber)
+	c.DisplayName = o.DisplayName
+	c.EmployeeNumber = o.EmployeeNumber
+	c.EmployeeType = make([]string, len(o.EmployeeType))
+	copy(c.EmployeeType, o.EmployeeType)
+	c.GivenName = make([]string, len(o.GivenName))
+	copy(c.GivenName, o.GivenName)
+	c.HomePhone = make([]string, len(o.HomePhone))
+	copy(c.HomePhone, o.HomePhone)
+	c.HomePostalAddress = make([]string, len(o.HomePostalAddress))
+	copy(c.HomePostalAddress, o.HomePostalAddress)
+	c.Initials = make([]string, len(o.Initials))
+	copy(c.Initials, o.Initials)
+	c.JpegPhoto = make([][]byte, len(o.JpegPhoto))
+	for i, v := range o.JpegPhoto {
+		c.JpegPhoto[i] = make([]byte, len(v))
+		copy(c.JpegPhoto[i], v)
+	}
+	c.LabeledURI = make([]string, len(o.LabeledURI))
+	copy(c.LabeledURI, o.LabeledURI)
+	c.Mail = make([]string, len(o.Mail))
+	copy(c.Mail, o.Mail)
+	c.Manager = make([]string, len(o.Manager))
+	copy(c.Manager, o.Manager)
+	c.Mobile = make([]string, len(o.Mobile))
+	copy(c.Mobile, o.Mobile)
+	c.O = make([]string, len(o.O))
+	copy(c.O, o.O)
+	c.Pager = make([]string, len(o.Pager))
+	copy(c.Pager, o.Pager)
+	c.Photo = make([]string, len(o.Photo))
+	copy(c.Photo, o.Photo)
+	c.PreferredLanguage = o.PreferredLanguage
+	c.RoomNumber = make([]string, len(o.RoomNumber))
+	copy(c.RoomNumber, o.RoomNumber)
+	c.Secretary = make([]string, len(o.Secretary))
+	copy(c.Secretary, o.Secretary)
+	c.Uid = make([]string, len(o.Uid))
+	copy(c.Uid, o.Uid)
+	c.UserCertificate = make([][]byte, len(o.UserCertificate))
+	for i, v := range o.UserCertificate {
+		c.UserCertificate[i] = make([]byte, len(v))
+		copy(c.UserCertificate[i], v)
+	}
+	c.UserPKCS12 = make([][]byte, len(o.UserPKCS12))
+	for i, v := range o.UserPKCS12 {
+		c.UserPKCS12[i] = make([]byte, len(v))
+		copy(c.UserPKCS12[i], v)
+	}
+	c.UserSMIMECertificate = make([][]byte, len(o.UserSMIMECertificate))
+	for i, v := range o.UserSMIMECertificate {
+		c.UserSMIMECertificate[i] = make([]byte, len(v))
+		copy(c.UserSMIMECertificate[i], v)
+	}
+	c.X500uniqueIdentifier = make([]string, len(o.X500uniqueIdentifier))
+	copy(c.X500uniqueIdentifier, o.X500uniqueIdentifier)
+	return c
+}
+
+func (o *Employee) Dn() string {
+	return o.dn
+}
+
+func (o *Employee) FormatDn() {
+	var v0 string
+	if len(o.Uid) > 0 {
+		v0 = o.Uid[0]
+	}
+	o.dn = fmt.Sprintf("uid=%v", v0)
+}
+
+func (o *Employee) MarshalLDAP() (*ldap.Entry, error) {
+	e := ldap.NewEntry(o.dn)
+
+	if o.InetOrgPerson {
+		e.AddAttributeValue("objectClass", "inetOrgPerson")
+
+		e.AddAttributeValues("audio", o.Audio)
+		e.AddAttributeValues("businessCategory", o.BusinessCategory)
+		e.AddAttributeValues("carLicense", o.CarLicense)
+		e.AddAttributeValues("departmentNumber", o.DepartmentNumber)
+		e.AddAttributeValue("displayName", o.DisplayName)
+		e.AddAttributeValue("employeeNumber", o.EmployeeNumber)
+		e.AddAttributeValues("employeeType", o.EmployeeType)
+		e.AddAttributeValues("givenName", o.GivenName)
+		e.AddAttributeValues("homePhone", o.HomePhone)
+		e.AddAttributeValues("homePostalAddress", o.HomePostalAddress)
+		e.AddAttributeValues("initials", o.Initials)
+		crud.AddAttributeBinaryValues(e, "jpegPhoto", o.JpegPhoto...)
+		e.AddAttributeValues("labeledURI", o.LabeledURI)
+		e.AddAttributeValues("mail", o.Mail)
+		e.AddAttributeValues("manager", o.Manager)
+		e.AddAttributeValues("mobile", o.Mobile)
+		e.AddAttributeValues("o", o.O)
+		e.AddAttributeValues("pager", o.Pager)
+		e.AddAttributeValues("photo", o.Photo)
+		e.AddAttributeValue("preferredLanguage", o.PreferredLanguage)
+		e.AddAttributeValues("roomNumber", o.RoomNumber)
+		e.AddAttributeValues("secretary", o.Secretary)
+		e.AddAttributeValues("uid", o.Uid)
+		crud.AddAttributeBinaryValues(e, "userCertificate;binary", o.UserCertificate...)
+		crud.AddAttributeBinaryValues(e, "userPKCS12", o.UserPKCS12...)
+		crud.AddAttributeBinaryValues(e, "userSMIMECertificate", o.UserSMIMECertificate...)
+		e.AddAttributeValues("x500uniqueIdentifier", o.X500uniqueIdentifier)
+	}
+	return e, nil
+}
+
+func (o *Employee) UnmarshalLDAP(e *ldap.Entry) error {
+	o.dn = e.DN
+
+	for _, v := range e.GetAttributeValues("objectClass") {
+		switch strings.ToLower(v) {
+		case "inetorgperson":
+			o.InetOrgPerson = true
+
+		}
+	}
+
+	o.Audio = e.GetAttributeValues("audio")
+	o.BusinessCategory = e.GetAttributeValues("businessCategory")
+	o.CarLicense = e.GetAttributeValues("carLicense")
+	o.DepartmentNumber = e.GetAttributeValues("departmentNumber")
+	o.DisplayName = e.GetAttributeValue("displayName")
+	o.EmployeeNumber = e.GetAttributeValue("employeeNumber")
+	o.EmployeeType = e.GetAttributeValues("employeeType")
+	o.GivenName = e.GetAttributeValues("givenName")
+	o.HomePhone = e.GetAttributeValues("homePhone")
+	o.HomePostalAddress = e.GetAttributeValues("homePostalAddress")
+	o.Initials = e.GetAttributeValues("initials")
+	o.JpegPhoto = crud.GetAttributeBinaryValues(e, "jpegPhoto")
+	o.LabeledURI = e.GetAttributeValues("labeledURI")
+	o.Mail = e.GetAttributeValues("mail")
+	o.Manager = e.GetAttributeValues("manager")
+	o.Mobile = e.GetAttributeValues("mobile")
+	o.O = e.GetAttributeValues("o")
+	o.Pager = e.GetAttributeValues("pager")
+	o.Photo = e.GetAttributeValues("photo")
+	o.PreferredLanguage = e.GetAttributeValue("preferredLanguage")
+	o.RoomNumber = e.GetAttributeValues("roomNumber")
+	o.Secretary = e.GetAttributeValues("secretary")
+	o.Uid = e.GetAttributeValues("uid")
+	o.UserCertificate = crud.GetAttributeBinaryValues(e, "userCertificate")
+	o.UserPKCS12 = crud.GetAttributeBinaryValues(e, "userPKCS12")
+	o.UserSMIMECertificate = crud.GetAttributeBinaryValues(e, "userSMIMECertificate")
+	o.X500uniqueIdentifier = e.GetAttributeValues("x500uniqueIdentifier")
+	return nil
+}
@@ -0,0 +1,50 @@
+package objects
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEmployeeBinary(t *testing.T) {
+	o := NewEmployee("")
+	o.InetOrgPerson = true
+	o.Uid = []string{"fritz"}
+	o.JpegPhoto = [][]byte{{0xff, 0xd8, 0x00, 0xff}}
+	o.UserCertificate = [][]byte{{0x30, 0x82, 0x00, 0x01}}
+	o.FormatDn()
+
+	e, err := o.MarshalLDAP()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.DN != "uid=fritz" {
+		t.Error("unexpected dn:", e.DN)
+	}
+
+	// certificates are transferred with the binary option
+	if len(e.GetAttributeValues("userCertificate;binary")) != 1 {
+		t.Error("expected userCertificate;binary, got", e.Attributes)
+	}
+
+	u := NewEmployee("")
+	err = u.UnmarshalLDAP(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(u.JpegPhoto) != 1 || !bytes.Equal(u.JpegPhoto[0], o.JpegPhoto[0]) {
+		t.Error("unexpected jpegPhoto:", u.JpegPhoto)
+	}
+
+	if len(u.UserCertificate) != 1 || !bytes.Equal(u.UserCertificate[0], o.UserCertificate[0]) {
+		t.Error("unexpected userCertificate:", u.UserCertificate)
+	}
+
+	// copies don't share the values
+	c := u.Copy().(*Employee)
+	c.JpegPhoto[0][0] = 0
+	if u.JpegPhoto[0][0] != 0xff {
+		t.Error("copy shares the jpegPhoto values")
+	}
+}
@@ -44,7 +44,11 @@ return o.dn
 }
 
 {{ if .DNFormat }}func (o *{{ .Name }})FormatDn() {
-o.dn = fmt.Sprintf("{{ .DNFormat }}", []string{ {{range $v := .DNAttributes}}o.{{$v | title | replace }}, {{end}} }...)
+{{ range $i, $v := .DNAttributes }}{{ if $v.SingleValue }}v{{ $i }} := o.{{ $v.Name | title | replace }}{{ else }}var v{{ $i }} string
+if len(o.{{ $v.Name | title | replace }}) > 0 {
+v{{ $i }} = o.{{ $v.Name | title | replace }}[0]
+}{{ end }}
+{{ end }}o.dn = fmt.Sprintf("{{ .DNFormat }}", {{ range $i, $v := .DNAttributes }}v{{ $i }}, {{ end }})
 }{{end}}
 
 func (o *{{ .Name }})MarshalLDAP() (*ldap.Entry, error) {
@@ -78,15 +82,20 @@ for _, v := range e.GetAttributeValues("objectClass") {
 return nil
 }{{end}}
 {{define "ATDECL"}}{{ range $k, $v := . }} // {{ $v.Desc }}
-{{$k | title | replace }} {{ if $v.SingleValue}}string{{else}}[]string{{end}} ` + "`json:\",omitempty\"`" + `
+{{$k | title | replace }} {{ if $v.Binary }}{{ if $v.SingleValue }}[]byte{{else}}[][]byte{{end}}{{else if $v.SingleValue}}string{{else}}[]string{{end}} ` + "`json:\",omitempty\"`" + `
 {{end}}{{end}}
 {{define "ATCOPY" }}{{ range $k, $v := . }}
-{{ if $v.SingleValue }}c.{{ $k | title | replace }} = o.{{ $k | title | replace }}{{else}}c.{{ $k | title | replace }} = make([]string, len(o.{{ $k | title | replace}}))
+{{ if $v.Binary }}{{ if $v.SingleValue }}c.{{ $k | title | replace }} = make([]byte, len(o.{{ $k | title | replace }}))
+copy(c.{{ $k | title | replace }}, o.{{ $k | title | replace }}){{else}}c.{{ $k | title | replace }} = make([][]byte, len(o.{{ $k | title | replace }}))
+for i, v := range o.{{ $k | title | replace }} {
+c.{{ $k | title | replace }}[i] = make([]byte, len(v))
+copy(c.{{ $k | title | replace }}[i], v)
+}{{end}}{{else if $v.SingleValue }}c.{{ $k | title | replace }} = o.{{ $k | title | replace }}{{else}}c.{{ $k | title | replace }} = make([]string, len(o.{{ $k | title | replace}}))
 copy(c.{{ $k | title | replace }}, o.{{ $k | title | replace }}){{end}}{{end}}{{end}}
 {{define "ATMARSHAL" }}{{range $k, $v := .}}
-{{ if $v.SingleValue }}e.AddAttributeValue("{{ $k }}", o.{{ $k | title | replace }}){{else}}e.AddAttributeValues("{{ $k }}", o.{{ $k | title | replace }}){{end}}{{end}}{{end}}
+{{ if $v.Binary }}crud.AddAttributeBinaryValues(e, "{{ $k }}{{ if $v.TransferBinary }};binary{{ end }}", o.{{ $k | title | replace }}{{ if not $v.SingleValue }}...{{ end }}){{else if $v.SingleValue }}e.AddAttributeValue("{{ $k }}", o.{{ $k | title | replace }}){{else}}e.AddAttributeValues("{{ $k }}", o.{{ $k | title | replace }}){{end}}{{end}}{{end}}
 {{define "ATUNMARSHAL" }}{{range $k, $v := .}}
-{{ if $v.SingleValue }}o.{{ $k | title | replace }} = e.GetAttributeValue("{{ $k }}"){{else}}o.{{ $k | title | replace }} = e.GetAttributeValues("{{ $k }}"){{end}}{{end}}{{end}}
+{{ if $v.Binary }}{{ if $v.SingleValue }}o.{{ $k | title | replace }} = crud.GetAttributeBinaryValue(e, "{{ $k }}"){{else}}o.{{ $k | title | replace }} = crud.GetAttributeBinaryValues(e, "{{ $k }}"){{end}}{{else if $v.SingleValue }}o.{{ $k | title | replace }} = e.GetAttributeValue("{{ $k }}"){{else}}o.{{ $k | title | replace }} = e.GetAttributeValues("{{ $k }}"){{end}}{{end}}{{end}}
 {{ template "OB" . }}
 `
 
@@ -102,6 +111,12 @@ type Object struct {
 	DNAttributes      []string
 }
 
+// an attribute used to format the dn, multi-valued attributes contribute their first value
+type dnAttribute struct {
+	Name        string
+	SingleValue bool
+}
+
 // Generates Go-code for itself. The struct and it's methods implement the Item interface of
 // package crud.
 func (o Object) Code() (string, error) {
@@ -125,7 +140,7 @@ func (o Object) Code() (string, error) {
 		}
 		FilterObjectClass string
 		DNFormat          string
-		DNAttributes      []string
+		DNAttributes      []dnAttribute
 		Must              map[string]*attributetype
 		May               map[string]*attributetype
 	}{Name: o.Name, Desc: o.Desc, FilterObjectClass: o.FilterObjectClass}
@@ -197,19 +212,19 @@ func (o Object) Code() (string, error) {
 	}
 
 	for _, v := range o.DNAttributes {
-		if _, ok := data.Must[v]; ok {
-			continue
+		attr, ok := data.Must[v]
+		if !ok {
+			attr, ok = data.May[v]
 		}
 
-		if _, ok := data.May[v]; ok {
-			continue
+		if !ok {
+			return "", errors.New(fmt.Sprintf("Undefined attribute %v in DNAttributes", v))
 		}
 
-		return "", errors.New(fmt.Sprintf("Undefined attribute %v in DNAttributes", v))
+		data.DNAttributes = append(data.DNAttributes, dnAttribute{Name: v, SingleValue: attr.SingleValue})
 	}
 
 	data.DNFormat = o.DNFormat
-	data.DNAttributes = o.DNAttributes
 
 	var w bytes.Buffer
 	err := t.Execute(&w, data)
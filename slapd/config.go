@@ -1,12 +1,27 @@
 package slapd
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"github.com/bytemine/ldap-crud/ldif"
+	"github.com/rbns/ldap"
+	"io"
 	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"text/template"
+	"time"
 )
 
 var DefaultConfig = Config{
@@ -27,7 +42,7 @@ var DefaultConfig = Config{
 	LdifTemplate:   DefaultLdifTemplate,
 }
 
-// Default LDIF generation template, used to add the suffix and root objects with ldapadd
+// Default LDIF generation template, used to add the suffix and root objects with Seed
 var DefaultLdifTemplate = `
 {{range $i, $o := . }}dn: {{ $o.Dn }}
 {{range $k, $vs := $o.Attributes}}{{range $i, $v := $vs }}{{ $k }}: {{ $v }}
@@ -40,12 +55,25 @@ var DefaultLdifTemplate = `
 var DefaultConfigTemplate = `
 {{range $i, $v := .Schemas}}include {{$v}}
 {{end}}
+{{if .ModulePath}}modulepath {{.ModulePath}}{{end}}
+{{range $i, $v := .Modules}}moduleload {{$v}}
+{{end}}
+{{if .Uid}}
+authz-regexp "gidNumber=[0-9]+\\+uidNumber={{.Uid}},cn=peercred,cn=external,cn=auth" "{{.Rootdn}}"
+{{end}}
+{{if .TLSCertificateFile}}
+TLSCertificateFile {{.TLSCertificateFile}}
+TLSCertificateKeyFile {{.TLSKeyFile}}
+{{end}}
 
 database {{.DBType}}
 suffix {{.Suffix}}
 rootdn {{.Rootdn}}
 rootpw {{.Rootpw}}
 directory {{.Db}}
+{{range $i, $v := .Overlays}}
+overlay {{$v}}
+{{end}}
 
 access to attrs=userPassword
         by self write
@@ -70,6 +98,19 @@ type Config struct {
 	// listen address and port of slapd in the format "host:port"
 	Addr string
 
+	// listen address and port of slapd for ldaps in the format "host:port". If empty,
+	// slapd doesn't listen for ldaps.
+	TLSAddr string
+
+	// Listen on an ldapi:// unix socket in the slapd directory. Connections from the current
+	// user authenticating with SASL EXTERNAL on it are bound as root object.
+	Ldapi bool
+
+	// TLS certificate and key files, used for ldaps and StartTLS. If they are empty and
+	// TLSAddr is set, Configure generates a self-signed certificate.
+	TLSCertificateFile string
+	TLSKeyFile         string
+
 	// base dn suffix
 	Suffix Object
 
@@ -79,13 +120,20 @@ type Config struct {
 	//schema files to include
 	Schemas []string
 
+	// path to load modules from and modules to load, e.g. "syncprov"
+	ModulePath string
+	Modules    []string
+
+	// overlays to use for the database, e.g. "syncprov"
+	Overlays []string
+
 	// database type
 	DBType string
 
 	// slapd.conf template
 	ConfigTemplate string
 
-	// LDIF template to use for adding suffix and root objects. Used with ldapadd.
+	// LDIF template to use for adding suffix and root objects. Used with Seed.
 	LdifTemplate string
 
 	// base dir for slapd config and db
@@ -96,6 +144,10 @@ type Config struct {
 
 	// slapd config file
 	file *os.File
+
+	// TLS certificate and key files in use
+	certFile string
+	keyFile  string
 }
 
 // url returns an url to connect to the slapd in the format "ldap://address"
@@ -103,6 +155,87 @@ func (c *Config) url() string {
 	return fmt.Sprintf("ldap://%v", c.Addr)
 }
 
+// urls returns the urls slapd listens on, separated by spaces
+func (c *Config) urls() string {
+	urls := []string{c.url()}
+	if c.TLSAddr != "" {
+		urls = append(urls, fmt.Sprintf("ldaps://%v", c.TLSAddr))
+	}
+	if c.Ldapi {
+		urls = append(urls, c.LdapiURL())
+	}
+
+	return strings.Join(urls, " ")
+}
+
+// Address returns the address slapd listens on for ldap:// connections.
+func (c *Config) Address() string {
+	return c.Addr
+}
+
+// LdapiURL returns the url of the ldapi:// socket slapd listens on if Ldapi is set.
+// It is only valid after Configure.
+func (c *Config) LdapiURL() string {
+	return fmt.Sprintf("ldapi://%v", url.PathEscape(filepath.Join(c.dir, "ldapi")))
+}
+
+// CertificateFile returns the TLS certificate file slapd uses, e.g. to be
+// added to the trusted certificates of a client. It is only set after Configure.
+func (c *Config) CertificateFile() string {
+	return c.certFile
+}
+
+// generateCertificate writes a self-signed certificate and its key for the host of
+// TLSAddr to the slapd directory
+func (c *Config) generateCertificate() error {
+	host, _, err := net.SplitHostPort(c.TLSAddr)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	c.certFile = filepath.Join(c.dir, "cert.pem")
+	err = ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0644)
+	if err != nil {
+		return err
+	}
+
+	c.keyFile = filepath.Join(c.dir, "key.pem")
+	return ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+}
+
 // Create a configuration and a slapd process struct which uses this config
 func (c *Config) Configure() (*exec.Cmd, error) {
 	var err error
@@ -117,18 +250,38 @@ func (c *Config) Configure() (*exec.Cmd, error) {
 		return nil, err
 	}
 
+	c.certFile, c.keyFile = c.TLSCertificateFile, c.TLSKeyFile
+	if c.TLSAddr != "" && c.certFile == "" {
+		err = c.generateCertificate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	c.file, err = ioutil.TempFile(c.dir, "slapd")
 
 	t := template.Must(template.New("slapdconfig").Parse(c.ConfigTemplate))
 
 	templateConfig := struct {
-		Schemas []string
-		DBType  string
-		Suffix  string
-		Rootdn  string
-		Rootpw  string
-		Db      string
-	}{Schemas: c.Schemas, DBType: c.DBType, Suffix: c.Suffix.Dn, Rootdn: c.Rootdn.Dn, Rootpw: c.Rootdn.Password, Db: c.db}
+		Schemas            []string
+		DBType             string
+		Suffix             string
+		Rootdn             string
+		Rootpw             string
+		Db                 string
+		TLSCertificateFile string
+		TLSKeyFile         string
+		Uid                string
+		ModulePath         string
+		Modules            []string
+		Overlays           []string
+	}{Schemas: c.Schemas, DBType: c.DBType, Suffix: c.Suffix.Dn, Rootdn: c.Rootdn.Dn, Rootpw: c.Rootdn.Password, Db: c.db,
+		TLSCertificateFile: c.certFile, TLSKeyFile: c.keyFile, ModulePath: c.ModulePath, Modules: c.Modules,
+		Overlays: c.Overlays}
+
+	if c.Ldapi {
+		templateConfig.Uid = fmt.Sprint(os.Getuid())
+	}
 
 	err = t.Execute(c.file, templateConfig)
 	if err != nil {
@@ -140,7 +293,7 @@ func (c *Config) Configure() (*exec.Cmd, error) {
 		return nil, err
 	}
 
-	cmd := exec.Command("slapd", "-d", fmt.Sprintf("%v", c.Loglevel), "-h", c.url(), "-f", c.file.Name())
+	cmd := exec.Command("slapd", "-d", fmt.Sprintf("%v", c.Loglevel), "-h", c.urls(), "-f", c.file.Name())
 
 	return cmd, nil
 }
@@ -158,28 +311,32 @@ func (c *Config) Initialize() error {
 
 	t := template.Must(template.New("ldif").Parse(c.LdifTemplate))
 
-	cmd := exec.Command("ldapadd", "-x", "-D", c.Rootdn.Dn, "-w", c.Rootdn.Password, "-H", c.url())
-
-	cmd.Stderr = os.Stdout
-
-	stdinPipe, err := cmd.StdinPipe()
+	var buf bytes.Buffer
+	err := t.Execute(&buf, objects)
 	if err != nil {
 		return err
 	}
 
-	err = cmd.Start()
+	return c.Seed(&buf)
+}
+
+// Seed adds the entries and applies the changes of the LDIF read from r, e.g. test
+// fixtures. It connects to slapd and binds as root object.
+func (c *Config) Seed(r io.Reader) error {
+	conn := ldap.NewConnection(c.Addr)
+	err := conn.Connect()
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
-	err = t.Execute(stdinPipe, objects)
+	err = conn.Bind(c.Rootdn.Dn, c.Rootdn.Password)
 	if err != nil {
 		return err
 	}
 
-	stdinPipe.Close()
-
-	return cmd.Wait()
+	_, err = ldif.Apply(conn, ldif.NewReader(r), false)
+	return err
 }
 
 // Clean removes all entries from the ldap. You have to run Initialize() again to re-add the admin entry.
@@ -53,7 +53,7 @@ func Example_manual() {
 	// Manually start a slapd configured like DefaultConfig (or your own).
 
 	// Add basedn and rootdn entries.
-	err = DefaultConfig.Initialize()
+	err := DefaultConfig.Initialize()
 	if err != nil {
 		log.Fatal(err)
 	}
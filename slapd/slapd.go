@@ -0,0 +1,78 @@
+package slapd
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"time"
+)
+
+// Time to wait for slapd to accept connections
+var StartTimeout = 10 * time.Second
+
+// A Slapd is a slapd process configured by Config.
+type Slapd struct {
+	Config *Config
+
+	cmd *exec.Cmd
+}
+
+// New returns a Slapd configured by c, or by DefaultConfig if c is nil.
+func New(c *Config) *Slapd {
+	if c == nil {
+		c = &DefaultConfig
+	}
+
+	return &Slapd{Config: c}
+}
+
+// Start configures and starts slapd and waits until it accepts connections on Addr.
+func (s *Slapd) Start() error {
+	cmd, err := s.Config.Configure()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		s.Config.Unconfigure()
+		return err
+	}
+	s.cmd = cmd
+
+	deadline := time.Now().Add(StartTimeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", s.Config.Addr)
+		if err == nil {
+			return conn.Close()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	s.Stop()
+	return errors.New("slapd didn't accept connections in time.")
+}
+
+// StartAndInitialize starts slapd and adds the suffix and root objects.
+func (s *Slapd) StartAndInitialize() error {
+	err := s.Start()
+	if err != nil {
+		return err
+	}
+
+	return s.Config.Initialize()
+}
+
+// Stop kills slapd and removes the directory created by Configure.
+func (s *Slapd) Stop() error {
+	if s.cmd == nil {
+		return nil
+	}
+
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+	s.cmd = nil
+
+	return s.Config.Unconfigure()
+}